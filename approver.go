@@ -0,0 +1,217 @@
+package assembly
+
+import (
+	"errors"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+)
+
+// Approver confirms the changes before they are applied. It's asked only in
+// interactive mode, after ApprovalRequested is emitted. By default the user is
+// prompted in the console.
+type Approver interface {
+	// ApproveSync is asked before the changes of the stack or of the stack set
+	// are applied. The sync is canceled if it returns an error.
+	ApproveSync(r SyncApproval) error
+
+	// ApproveDelete is asked before the stack is deleted. The deletion is
+	// canceled if it returns an error.
+	ApproveDelete(r DeleteApproval) (DeleteDecision, error)
+}
+
+// SyncApproval describes the changes that are about to be applied.
+type SyncApproval struct {
+	Stack string
+
+	// ChangeSet and ChangeSetHandle are the change set of the stack and the
+	// registered one. They are nil for stack sets.
+	ChangeSet       *awscf.ChangeSet
+	ChangeSetHandle *awscf.ChangeSetHandle
+
+	// StackSetPlan is the plan of the changes of the stack set. It's nil for
+	// stacks.
+	StackSetPlan *awscf.StackSetPlan
+}
+
+// DeleteApproval describes the stack that is about to be deleted.
+type DeleteApproval struct {
+	Stack    string
+	Deployed *awscf.Stack
+}
+
+// DeleteDecision is the decision of Approver on the deletion of the stack.
+type DeleteDecision int
+
+const (
+	// DeleteConfirmed confirms the deletion of the stack.
+	DeleteConfirmed DeleteDecision = iota
+	// DeleteAllConfirmed confirms the deletion of the stack and of all the
+	// stacks that follow it without asking again.
+	DeleteAllConfirmed
+	// DeleteSkipped keeps the stack and continues with the other stacks.
+	DeleteSkipped
+)
+
+// SetApprover replaces the console prompts with the approver.
+func (sa *SA) SetApprover(a Approver) {
+	sa.approver = a
+}
+
+// consoleApprover prompts the user in the console.
+type consoleApprover struct {
+	sa *SA
+}
+
+func (a consoleApprover) ApproveSync(r SyncApproval) error {
+	if r.ChangeSet == nil {
+		return a.confirmStackSetSync()
+	}
+
+	return a.chooseNextAction(r.ChangeSet, r.ChangeSetHandle)
+}
+
+func (a consoleApprover) chooseNextAction(cs *awscf.ChangeSet, chSet *awscf.ChangeSetHandle) error {
+	sa := *a.sa
+
+	var actionErr error
+
+	continueSync := false
+
+	for !continueSync && actionErr == nil {
+		err := sa.cli.Prompt([]cli.PromptCmd{
+			{
+				Description:   "[s]ync",
+				TriggerInputs: []string{"s", "sync"},
+				Action: func() {
+					continueSync = true
+				},
+			},
+			{
+				Description:   "[d]iff",
+				TriggerInputs: []string{"d", "diff"},
+				Action: func() {
+					differ := sa.differ()
+
+					diff, derr := differ.Diff(cs)
+					if derr == nil {
+						sa.cli.Print(diff)
+
+						diff, derr = differ.DiffNested(chSet)
+					}
+
+					actionErr = derr
+
+					if derr == nil && diff != "" {
+						sa.cli.Print(diff)
+					}
+				},
+			},
+			{
+				Description:   "[c]hanges (show changed properties)",
+				TriggerInputs: []string{"c", "changes"},
+				Action: func() {
+					sa.showChangeDetails(chSet.Changes)
+				},
+			},
+			{
+				Description:   "[q]uit",
+				TriggerInputs: []string{"q", "quit"},
+				Action: func() {
+					sa.cli.Error("Interrupted by user")
+					actionErr = errors.New("sync is canceled")
+				},
+			},
+		})
+		if err != nil && !errors.Is(err, cli.ErrPromptCommandIsNotKnown) {
+			return err
+		}
+	}
+
+	return actionErr
+}
+
+func (a consoleApprover) confirmStackSetSync() error {
+	sa := *a.sa
+
+	var actionErr error
+
+	continueSync := false
+
+	for !continueSync && actionErr == nil {
+		err := sa.cli.Prompt([]cli.PromptCmd{
+			{
+				Description:   "[s]ync",
+				TriggerInputs: []string{"s", "sync"},
+				Action: func() {
+					continueSync = true
+				},
+			},
+			{
+				Description:   "[q]uit",
+				TriggerInputs: []string{"q", "quit"},
+				Action: func() {
+					sa.cli.Error("Interrupted by user")
+					actionErr = errors.New("sync is canceled")
+				},
+			},
+		})
+		if err != nil && !errors.Is(err, cli.ErrPromptCommandIsNotKnown) {
+			return err
+		}
+	}
+
+	return actionErr
+}
+
+func (a consoleApprover) ApproveDelete(r DeleteApproval) (DeleteDecision, error) {
+	sa := *a.sa
+
+	for {
+		var (
+			decision  DeleteDecision
+			decided   bool
+			actionErr error
+		)
+
+		err := sa.cli.Prompt([]cli.PromptCmd{{
+			Description:   "[d]elete",
+			TriggerInputs: []string{"d", "delete"},
+			Action: func() {
+				decision, decided = DeleteConfirmed, true
+			},
+		}, {
+			Description:   "[a]ll (delete all without asking again)",
+			TriggerInputs: []string{"a", "all"},
+			Action: func() {
+				decision, decided = DeleteAllConfirmed, true
+			},
+		}, {
+			Description:   "[i]nfo (show stack info)",
+			TriggerInputs: []string{"i", "info"},
+			Action: func() {
+				actionErr = sa.Info(r.Deployed)
+			},
+		}, {
+			Description:   "[s]kip",
+			TriggerInputs: []string{"s", "skip"},
+			Action: func() {
+				decision, decided = DeleteSkipped, true
+			},
+		}, {
+			Description:   "[q]uit",
+			TriggerInputs: []string{"q", "quit"},
+			Action: func() {
+				sa.cli.Error("Interrupted by user")
+				actionErr = errors.New("deletion is canceled")
+			},
+		}})
+		if err != nil && !errors.Is(err, cli.ErrPromptCommandIsNotKnown) {
+			return decision, err
+		}
+
+		if actionErr != nil || decided {
+			return decision, actionErr
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package aws
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	awssdk "github.com/aws/aws-sdk-go/aws"
@@ -12,12 +18,42 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/molecule-man/stack-assembly/cli"
 )
 
 type Config struct {
-	Region   string
-	Profile  string
-	Endpoint string
+	Region  string
+	Profile string
+
+	// Endpoint is used by every service that doesn't have its own endpoint
+	// in Endpoints.
+	Endpoint  string
+	Endpoints Endpoints `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	// HTTPTimeoutSeconds is the timeout of the http requests to aws (2
+	// seconds by default). MaxRetries is the number of retries of the failed
+	// requests (7 by default).
+	HTTPTimeoutSeconds int `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	MaxRetries         int `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	// Proxy is the url of the http proxy. The proxy configured by the
+	// HTTPS_PROXY and NO_PROXY env variables is used if it's not set.
+	Proxy string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	// CABundle is the path to the PEM file with the certificates trusted in
+	// addition to the system ones.
+	CABundle string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	// S3ForcePathStyle is inherited unless it's set, so explicit false turns
+	// off the path style enabled by the parent config.
+	S3ForcePathStyle *bool `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	// AssumeRoleArn is the role assumed with the credentials of the profile.
+	// ExternalID belongs to the role, so it's inherited only together with
+	// the role.
+	AssumeRoleArn   string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	ExternalID      string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	SessionName     string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	DurationSeconds int    `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	MFASerial       string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
 }
 
 func (ac *Config) Merge(otherCfg Config) {
@@ -32,57 +68,218 @@ func (ac *Config) Merge(otherCfg Config) {
 	if ac.Endpoint == "" {
 		ac.Endpoint = otherCfg.Endpoint
 	}
+
+	ac.Endpoints.Merge(otherCfg.Endpoints)
+
+	if ac.HTTPTimeoutSeconds == 0 {
+		ac.HTTPTimeoutSeconds = otherCfg.HTTPTimeoutSeconds
+	}
+
+	if ac.MaxRetries == 0 {
+		ac.MaxRetries = otherCfg.MaxRetries
+	}
+
+	if ac.Proxy == "" {
+		ac.Proxy = otherCfg.Proxy
+	}
+
+	if ac.CABundle == "" {
+		ac.CABundle = otherCfg.CABundle
+	}
+
+	if ac.S3ForcePathStyle == nil {
+		ac.S3ForcePathStyle = otherCfg.S3ForcePathStyle
+	}
+
+	if ac.AssumeRoleArn == "" {
+		ac.AssumeRoleArn = otherCfg.AssumeRoleArn
+		ac.ExternalID = otherCfg.ExternalID
+	}
+
+	if ac.SessionName == "" {
+		ac.SessionName = otherCfg.SessionName
+	}
+
+	if ac.DurationSeconds == 0 {
+		ac.DurationSeconds = otherCfg.DurationSeconds
+	}
+
+	if ac.MFASerial == "" {
+		ac.MFASerial = otherCfg.MFASerial
+	}
+}
+
+// Endpoints override the endpoints of the individual services, e.g. to
+// point s3 to LocalStack while using the real sts.
+type Endpoints struct {
+	CloudFormation string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	S3             string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	STS            string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+func (e *Endpoints) Merge(other Endpoints) {
+	if e.CloudFormation == "" {
+		e.CloudFormation = other.CloudFormation
+	}
+
+	if e.S3 == "" {
+		e.S3 = other.S3
+	}
+
+	if e.STS == "" {
+		e.STS = other.STS
+	}
 }
 
-var awsPool = map[Config]*AWS{}
+// serviceConfig returns the config of the client of the service whose own
+// endpoint is given.
+func (ac Config) serviceConfig(endpoint string) *awssdk.Config {
+	if endpoint == "" {
+		endpoint = ac.Endpoint
+	}
+
+	return &awssdk.Config{Endpoint: nilString(endpoint)}
+}
+
+func (ac Config) stsConfig() *awssdk.Config {
+	return ac.serviceConfig(ac.Endpoints.STS)
+}
+
+func (ac Config) s3Config() *awssdk.Config {
+	c := ac.serviceConfig(ac.Endpoints.S3)
+	c.S3ForcePathStyle = awssdk.Bool(awssdk.BoolValue(ac.S3ForcePathStyle))
+
+	return c
+}
+
+// poolKey returns the value identifying the config in the pool. The pointers
+// are replaced with the values they point to, so that the equal configs share
+// the clients.
+func (ac Config) poolKey() interface{} {
+	type key struct {
+		Config
+		s3ForcePathStyle bool
+	}
+
+	k := key{ac, awssdk.BoolValue(ac.S3ForcePathStyle)}
+	k.Config.S3ForcePathStyle = nil
+
+	return k
+}
+
+// awsPool caches the clients per config, so that the stacks having the same
+// settings share the session, credentials and temporary bucket.
+var awsPool = &pool{}
 
 type AWS struct {
 	CF              cloudformationiface.CloudFormationAPI
 	S3UploadManager S3UploadManager
 	S3              s3iface.S3API
-	AccountID       string
 	Region          string
+
+	// AccountID is ID of the account the clients operate in. It's resolved
+	// by Account on the first use if it's not known beforehand, so it should
+	// be read with Account.
+	AccountID string
+
+	sts       stsiface.STSAPI
+	accountMu sync.Mutex
+	tmpBucket *tmpBucket
 }
 
-type Provider struct{}
+// Account returns ID of the account the clients operate in. The account is
+// requested from sts only once, when it's needed for the first time.
+func (a *AWS) Account() (string, error) {
+	a.accountMu.Lock()
+	defer a.accountMu.Unlock()
 
-func (p Provider) Must(cfg Config) *AWS {
-	a, err := p.New(cfg)
+	if a.AccountID != "" || a.sts == nil {
+		return a.AccountID, nil
+	}
 
+	callerIdent, err := a.sts.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("failed to get aws account id: %w", err)
 	}
 
-	return a
+	a.AccountID = awssdk.StringValue(callerIdent.Account)
+
+	return a.AccountID, nil
 }
 
-func (Provider) New(cfg Config) (*AWS, error) {
-	if aws, ok := awsPool[cfg]; ok {
-		return aws, nil
+// Provider creates AWS clients. Requests made by the clients are logged to
+// Logger if it's set. TokenPrompt asks for the MFA token code when the role
+// requires MFA; the token is read from stdin if TokenPrompt is nil.
+//
+// The clients are cached per config, so New returns the same clients for the
+// same config. Provider is safe for concurrent use.
+type Provider struct {
+	Logger      *cli.CLI
+	TokenPrompt func(mfaSerial string) (string, error)
+}
+
+func (p Provider) New(cfg Config) (*AWS, error) {
+	aws, err := awsPool.get(cfg.poolKey(), func() (interface{}, error) {
+		return p.newAWS(cfg)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	sess := initSession(cfg)
+	return aws.(*AWS), nil
+}
 
-	aws := AWS{}
+func (p Provider) newAWS(cfg Config) (*AWS, error) {
+	sess, err := initSession(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	aws.CF = cloudformation.New(sess)
-	aws.S3UploadManager = s3manager.NewUploader(sess)
-	aws.S3 = s3.New(sess)
-	aws.Region = awssdk.StringValue(sess.Config.Region)
+	if p.Logger != nil {
+		sess.Handlers.Complete.PushBack(requestLogger(p.Logger))
+	}
 
-	callerIdent, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
-	if err != nil {
-		return &aws, err
+	if cfg.AssumeRoleArn != "" || cfg.MFASerial != "" {
+		creds, credsErr := p.credentials(sess, cfg)
+		if credsErr != nil {
+			return nil, credsErr
+		}
+
+		sess = sess.Copy(&awssdk.Config{Credentials: creds})
 	}
 
-	aws.AccountID = awssdk.StringValue(callerIdent.Account)
+	aws := &AWS{tmpBucket: &tmpBucket{}}
 
-	awsPool[cfg] = &aws
+	aws.CF = cloudformation.New(sess, cfg.serviceConfig(cfg.Endpoints.CloudFormation))
+	aws.S3 = s3.New(sess, cfg.s3Config())
+	aws.S3UploadManager = s3manager.NewUploaderWithClient(aws.S3)
+	aws.Region = awssdk.StringValue(sess.Config.Region)
+	aws.sts = sts.New(sess, cfg.stsConfig())
 
-	return &aws, nil
+	return aws, nil
 }
 
-func initSession(cfg Config) *session.Session {
+// Cleanup removes the temporary buckets created to upload the templates
+// during the run.
+func (p Provider) Cleanup() error {
+	for _, v := range awsPool.values() {
+		aws := v.(*AWS)
+
+		if err := aws.tmpBucket.cleanup(aws.S3); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Defaults of the http client settings.
+const (
+	defaultHTTPTimeout = 2 * time.Second
+	defaultMaxRetries  = 7
+)
+
+func initSession(cfg Config) (*session.Session, error) {
 	opts := session.Options{}
 
 	if cfg.Profile != "" {
@@ -90,23 +287,76 @@ func initSession(cfg Config) *session.Session {
 	}
 
 	awsCfg := awssdk.Config{}
-	awsCfg.MaxRetries = awssdk.Int(7)
+
+	awsCfg.MaxRetries = awssdk.Int(defaultMaxRetries)
+	if cfg.MaxRetries > 0 {
+		awsCfg.MaxRetries = awssdk.Int(cfg.MaxRetries)
+	}
 
 	if cfg.Region != "" {
 		awsCfg.Region = awssdk.String(cfg.Region)
 	}
 
-	awsCfg.Endpoint = awssdk.String(cfg.Endpoint)
-
-	httpClient := http.Client{
-		Timeout: 2 * time.Second,
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
 	}
-	awsCfg.HTTPClient = &httpClient
+
+	awsCfg.HTTPClient = httpClient
 
 	opts.Config = awsCfg
 	opts.SharedConfigState = session.SharedConfigEnable
 
-	return session.Must(session.NewSessionWithOptions(opts))
+	return session.NewSessionWithOptions(opts)
+}
+
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url %s: %w", cfg.Proxy, err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CABundle != "" {
+		pool, err := certPool(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := defaultHTTPTimeout
+	if cfg.HTTPTimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.HTTPTimeoutSeconds) * time.Second
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// certPool returns the system certificates together with the ones of the
+// bundle.
+func certPool(bundle string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates are found in CA bundle %s", bundle)
+	}
+
+	return pool, nil
 }
 
 func nilString(s string) *string {
@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/molecule-man/stack-assembly/cli"
+)
+
+// redactedParams are the request parameters whose values are never logged.
+var redactedParams = map[string]bool{
+	"ParameterValue":  true,
+	"SecretAccessKey": true,
+	"SessionToken":    true,
+	"TokenCode":       true,
+	"SSECustomerKey":  true,
+	"Body":            true,
+}
+
+// requestLogger logs every request made by the clients of the session: on
+// debug level the operation, the stack (or bucket), duration and number of
+// retries; on trace level the parameters of the request as well.
+func requestLogger(log *cli.CLI) func(r *request.Request) {
+	return func(r *request.Request) {
+		if !log.Enabled(cli.LevelDebug) {
+			return
+		}
+
+		fields := cli.Fields{
+			"service":  r.ClientInfo.ServiceName,
+			"op":       r.Operation.Name,
+			"duration": time.Since(r.Time).Round(time.Millisecond).String(),
+			"retries":  r.RetryCount,
+		}
+
+		if stack := stringParam(r.Params, "StackName"); stack != "" {
+			fields["stack"] = stack
+		}
+
+		if bucket := stringParam(r.Params, "Bucket"); bucket != "" {
+			fields["bucket"] = bucket
+		}
+
+		if r.Error != nil {
+			var aerr awserr.Error
+			if errors.As(r.Error, &aerr) {
+				fields["error"] = aerr.Code()
+			} else {
+				fields["error"] = r.Error.Error()
+			}
+		}
+
+		log.Debug("aws request", fields)
+
+		if log.Enabled(cli.LevelTrace) {
+			log.Trace("aws request params", cli.Fields{"op": r.Operation.Name, "params": redactParams(r.Params)})
+		}
+	}
+}
+
+// stringParam returns the value of the string field of the request
+// parameters.
+func stringParam(params interface{}, name string) string {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	f := v.FieldByName(name)
+	if !f.IsValid() || f.Type() != reflect.TypeOf((*string)(nil)) {
+		return ""
+	}
+
+	return awssdk.StringValue(f.Interface().(*string))
+}
+
+// redactParams converts the request parameters into generic structure with
+// the values of secrets replaced. Template bodies are replaced with their size
+// to keep the log readable.
+func redactParams(params interface{}) interface{} {
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Sprintf("<failed to encode params: %s>", err)
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(buf, &generic); err != nil {
+		return fmt.Sprintf("<failed to encode params: %s>", err)
+	}
+
+	return redact(generic)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			switch {
+			case redactedParams[k]:
+				v[k] = "<redacted>"
+			case k == "TemplateBody":
+				if body, ok := val.(string); ok {
+					v[k] = fmt.Sprintf("<%d bytes>", len(body))
+				}
+			default:
+				v[k] = redact(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redact(val)
+		}
+	}
+
+	return v
+}
@@ -15,16 +15,6 @@ type ReadProvider struct {
 	scenarioID string
 }
 
-func (p ReadProvider) Must(cfg aws.Config) *aws.AWS {
-	a, err := p.New(cfg)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return a
-}
-
 func (p ReadProvider) New(cfg aws.Config) (*aws.AWS, error) {
 	d := newDumper(p.testID, p.featureID, p.scenarioID)
 
@@ -136,6 +126,11 @@ func (c *GfCloudFormation) DeleteStack(input *clf.DeleteStackInput) (*clf.Delete
 	return output, c.dumper.read("DeleteStack", input, output)
 }
 
+func (c *GfCloudFormation) DeleteChangeSet(input *clf.DeleteChangeSetInput) (*clf.DeleteChangeSetOutput, error) {
+	output := &clf.DeleteChangeSetOutput{}
+	return output, c.dumper.read("DeleteChangeSet", input, output)
+}
+
 func (c *GfCloudFormation) SetStackPolicy(input *clf.SetStackPolicyInput) (*clf.SetStackPolicyOutput, error) {
 	output := &clf.SetStackPolicyOutput{}
 	return output, c.dumper.read("SetStackPolicy", input, output)
@@ -15,16 +15,6 @@ type WriteProvider struct {
 	scenarioID string
 }
 
-func (p WriteProvider) Must(cfg aws.Config) *aws.AWS {
-	a, err := p.New(cfg)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return a
-}
-
 func (p WriteProvider) New(cfg aws.Config) (*aws.AWS, error) {
 	realP := aws.Provider{}
 
@@ -33,8 +23,13 @@ func (p WriteProvider) New(cfg aws.Config) (*aws.AWS, error) {
 		return raws, err
 	}
 
+	accountID, err := raws.Account()
+	if err != nil {
+		return nil, err
+	}
+
 	d := newDumper(p.testID, p.featureID, p.scenarioID)
-	d.addReplacement(raws.AccountID, "AWS_ACC_ID")
+	d.addReplacement(accountID, "AWS_ACC_ID")
 	d.addReplacement(raws.Region, "AWS_REGION")
 
 	cf := &CloudFormation{realCF: raws.CF, dumper: d}
@@ -44,7 +39,7 @@ func (p WriteProvider) New(cfg aws.Config) (*aws.AWS, error) {
 		CF:              cf,
 		S3UploadManager: s3,
 		S3:              raws.S3,
-		AccountID:       raws.AccountID,
+		AccountID:       accountID,
 		Region:          raws.Region,
 	}, nil
 }
@@ -120,6 +115,13 @@ func (c *CloudFormation) DeleteStack(input *clf.DeleteStackInput) (*clf.DeleteSt
 	return output, err
 }
 
+func (c *CloudFormation) DeleteChangeSet(input *clf.DeleteChangeSetInput) (*clf.DeleteChangeSetOutput, error) {
+	output, err := c.realCF.DeleteChangeSet(input)
+	c.dumper.dump("DeleteChangeSet", input, output, err)
+
+	return output, err
+}
+
 func (c *CloudFormation) WaitUntilChangeSetCreateCompleteWithContext(
 	ctx awssdk.Context,
 	input *clf.DescribeChangeSetInput,
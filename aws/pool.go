@@ -0,0 +1,70 @@
+package aws
+
+import "sync"
+
+// pool caches the values that are expensive to create, e.g. sessions and
+// credentials. It's safe for concurrent use: the value requested by several
+// goroutines at once is created only once and the others wait for it. Failed
+// creation is not cached, so it's retried on the next request.
+type pool struct {
+	mu      sync.Mutex
+	entries map[interface{}]*poolEntry
+}
+
+type poolEntry struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func (p *pool) get(key interface{}, create func() (interface{}, error)) (interface{}, error) {
+	p.mu.Lock()
+
+	if e, ok := p.entries[key]; ok {
+		p.mu.Unlock()
+		<-e.done
+
+		return e.val, e.err
+	}
+
+	if p.entries == nil {
+		p.entries = map[interface{}]*poolEntry{}
+	}
+
+	e := &poolEntry{done: make(chan struct{})}
+	p.entries[key] = e
+
+	p.mu.Unlock()
+
+	e.val, e.err = create()
+
+	if e.err != nil {
+		p.mu.Lock()
+		delete(p.entries, key)
+		p.mu.Unlock()
+	}
+
+	close(e.done)
+
+	return e.val, e.err
+}
+
+// values returns the values that are created successfully so far.
+func (p *pool) values() []interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	vals := make([]interface{}, 0, len(p.entries))
+
+	for _, e := range p.entries {
+		select {
+		case <-e.done:
+			if e.err == nil {
+				vals = append(vals, e.val)
+			}
+		default:
+		}
+	}
+
+	return vals
+}
@@ -0,0 +1,132 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const defaultSessionName = "stack-assembly"
+
+type mfaKey struct {
+	profile   string
+	mfaSerial string
+}
+
+type roleKey struct {
+	mfaKey
+	roleArn         string
+	externalID      string
+	sessionName     string
+	durationSeconds int
+}
+
+var (
+	mfaCredsPool  = &pool{}
+	roleCredsPool = &pool{}
+)
+
+// credentials returns the credentials of the role. The credentials are
+// cached per role and refreshed by the sdk when they expire. When MFA is
+// required, the session token is requested once per profile and MFA device,
+// so the user is prompted for the token code only once no matter how many
+// roles are assumed.
+func (p Provider) credentials(sess *session.Session, cfg Config) (*credentials.Credentials, error) {
+	mk := mfaKey{profile: cfg.Profile, mfaSerial: cfg.MFASerial}
+
+	if cfg.MFASerial != "" {
+		mfaCreds, err := p.mfaCredentials(sess, mk, cfg.stsConfig())
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.AssumeRoleArn == "" {
+			return mfaCreds, nil
+		}
+
+		sess = sess.Copy(&awssdk.Config{Credentials: mfaCreds})
+	}
+
+	rk := roleKey{
+		mfaKey:          mk,
+		roleArn:         cfg.AssumeRoleArn,
+		externalID:      cfg.ExternalID,
+		sessionName:     cfg.SessionName,
+		durationSeconds: cfg.DurationSeconds,
+	}
+
+	creds, err := roleCredsPool.get(rk, func() (interface{}, error) {
+		return assumeRole(sess, cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return creds.(*credentials.Credentials), nil
+}
+
+func assumeRole(sess *session.Session, cfg Config) (*credentials.Credentials, error) {
+	creds := stscreds.NewCredentials(sess, cfg.AssumeRoleArn, func(arp *stscreds.AssumeRoleProvider) {
+		arp.Client = sts.New(sess, cfg.stsConfig())
+		arp.RoleSessionName = defaultSessionName
+		if cfg.SessionName != "" {
+			arp.RoleSessionName = cfg.SessionName
+		}
+
+		if cfg.ExternalID != "" {
+			arp.ExternalID = awssdk.String(cfg.ExternalID)
+		}
+
+		if cfg.DurationSeconds > 0 {
+			arp.Duration = time.Duration(cfg.DurationSeconds) * time.Second
+		}
+	})
+
+	if _, err := creds.Get(); err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %w", cfg.AssumeRoleArn, err)
+	}
+
+	return creds, nil
+}
+
+func (p Provider) mfaCredentials(sess *session.Session, mk mfaKey, stsCfg *awssdk.Config) (*credentials.Credentials, error) {
+	creds, err := mfaCredsPool.get(mk, func() (interface{}, error) {
+		return p.sessionToken(sess, mk, stsCfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return creds.(*credentials.Credentials), nil
+}
+
+func (p Provider) sessionToken(sess *session.Session, mk mfaKey, stsCfg *awssdk.Config) (*credentials.Credentials, error) {
+	prompt := p.TokenPrompt
+	if prompt == nil {
+		prompt = func(string) (string, error) { return stscreds.StdinTokenProvider() }
+	}
+
+	code, err := prompt(mk.mfaSerial)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := sts.New(sess, stsCfg).GetSessionToken(&sts.GetSessionTokenInput{
+		SerialNumber: awssdk.String(mk.mfaSerial),
+		TokenCode:    awssdk.String(code),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session token with MFA device %s: %w", mk.mfaSerial, err)
+	}
+
+	return credentials.NewStaticCredentials(
+		awssdk.StringValue(out.Credentials.AccessKeyId),
+		awssdk.StringValue(out.Credentials.SecretAccessKey),
+		awssdk.StringValue(out.Credentials.SessionToken),
+	), nil
+}
@@ -1,12 +1,20 @@
 package aws
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
@@ -16,6 +24,14 @@ import (
 
 const bucketNameMaxLen = 63
 
+// TmpBucketPrefix is the prefix of the names of the buckets that are created
+// to upload templates when no bucket is configured.
+const TmpBucketPrefix = "stack-assembly-tmp-"
+
+// s3HostRe matches hosts of s3 urls. The first group is the bucket name when
+// the url is virtual-hosted-style.
+var s3HostRe = regexp.MustCompile(`^(?:(.+)\.)?s3(?:[.-][a-z0-9-]+)*\.amazonaws\.com(?:\.cn)?$`)
+
 type S3Settings struct {
 	BucketName string
 	Prefix     string
@@ -43,18 +59,44 @@ func (cfg *S3Settings) Merge(otherCfg S3Settings) {
 }
 
 func NewS3Uploader(mgr S3UploadManager, s3api s3iface.S3API, cfg S3Settings) *S3Uploader {
-	return &S3Uploader{cfg: cfg, s3: s3api, mgr: mgr}
+	return &S3Uploader{cfg: cfg, s3: s3api, mgr: mgr, tmp: &tmpBucket{}, ownsTmp: true}
+}
+
+// S3Uploader returns the uploader that shares the temporary bucket with the
+// other uploaders of the session, so that only one bucket is created per run
+// when no bucket is configured. The bucket is removed by Cleanup of the
+// provider.
+func (a *AWS) S3Uploader(cfg S3Settings) *S3Uploader {
+	if a.tmpBucket == nil {
+		return NewS3Uploader(a.S3UploadManager, a.S3, cfg).withRegion(a.Region)
+	}
+
+	return &S3Uploader{cfg: cfg, s3: a.S3, mgr: a.S3UploadManager, region: a.Region, tmp: a.tmpBucket}
 }
 
 type S3Uploader struct {
-	cfg S3Settings
-	mgr S3UploadManager
-	s3  s3iface.S3API
+	cfg    S3Settings
+	mgr    S3UploadManager
+	s3     s3iface.S3API
+	region string
+
+	tmp *tmpBucket
+	// ownsTmp is true if the temporary bucket is not shared with other
+	// uploaders and is removed by Cleanup of the uploader
+	ownsTmp bool
+}
 
-	autoGeneratedBucket string
+func (s *S3Uploader) withRegion(region string) *S3Uploader {
+	s.region = region
+	return s
 }
 
-func (s *S3Uploader) Upload(body string) (_ string, err error) {
+// Upload uploads the template body if it exceeds the threshold size and
+// returns its url. The key is derived from the stack name and the sha256 of
+// the body, so the stacks sharing the bucket don't overwrite each other's
+// templates and the template that is already uploaded is not uploaded again.
+// Empty url is returned if the body is small enough to be passed inline.
+func (s *S3Uploader) Upload(stackName, body string) (_ string, err error) {
 	defer errd.Wrapf(&err, "failed to upload template body")
 
 	maxSize := 51200
@@ -67,83 +109,285 @@ func (s *S3Uploader) Upload(body string) (_ string, err error) {
 		return "", nil // no need to do upload, the size is not over threshold
 	}
 
-	bucketName := s.cfg.BucketName
+	bucketName, err := s.bucket()
+	if err != nil {
+		return "", err
+	}
 
-	if bucketName == "" {
-		bucketName = fmt.Sprintf("stack-assembly-tmp-%d-%x", time.Now().UnixNano(), crc32.ChecksumIEEE([]byte(body)))
-		if len(bucketName) > bucketNameMaxLen {
-			bucketName = bucketName[:bucketNameMaxLen]
-		}
+	key := s.key(stackName, body)
 
-		s.autoGeneratedBucket = bucketName
+	_, err = s.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket: nilString(bucketName),
+		Key:    nilString(key),
+	})
+	if err == nil {
+		return s.objectURL(bucketName, key)
 	}
 
-	_, err = s.s3.CreateBucket(&s3.CreateBucketInput{
-		Bucket: nilString(bucketName),
+	_, err = s.mgr.Upload(&s3manager.UploadInput{
+		Bucket:      nilString(bucketName),
+		Key:         nilString(key),
+		SSEKMSKeyId: nilString(s.cfg.KMSKeyID),
+		Body:        strings.NewReader(body),
 	})
+	if err != nil {
+		return "", &BucketError{Op: "upload template to s3", Bucket: bucketName, Err: err}
+	}
+
+	return s.objectURL(bucketName, key)
+}
+
+func (s *S3Uploader) key(stackName, body string) string {
+	prefix := s.cfg.Prefix
+	if prefix == "" {
+		prefix = "stack-assembly"
+	}
+
+	sum := sha256.Sum256([]byte(body))
+
+	return path.Join(prefix, stackName, hex.EncodeToString(sum[:]))
+}
+
+// bucket returns the configured bucket or the temporary one. The bucket is
+// created if it doesn't exist yet.
+func (s *S3Uploader) bucket() (string, error) {
+	if s.cfg.BucketName != "" {
+		return s.cfg.BucketName, s.createBucket(s.cfg.BucketName)
+	}
+
+	return s.tmp.ensure(s.createBucket)
+}
+
+func (s *S3Uploader) createBucket(bucketName string) error {
+	input := &s3.CreateBucketInput{Bucket: nilString(bucketName)}
+
+	// us-east-1 is the default location and can't be set explicitly
+	if s.region != "" && s.region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: nilString(s.region),
+		}
+	}
+
+	_, err := s.s3.CreateBucket(input)
 
 	var aerr awserr.Error
 	if err != nil && !(errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou) {
-		return "", &BucketError{Op: "create s3 bucket", Bucket: bucketName, Err: err}
+		return &BucketError{Op: "create s3 bucket", Bucket: bucketName, Err: err}
 	}
 
 	err = s.s3.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: nilString(bucketName)})
 	if err != nil {
-		return "", &BucketError{Op: "create s3 bucket", Bucket: bucketName, Err: err}
+		return &BucketError{Op: "create s3 bucket", Bucket: bucketName, Err: err}
 	}
 
-	prefix := s.cfg.Prefix
-	if prefix == "" {
-		prefix = "stack-assembly"
-	}
+	return nil
+}
 
-	r, err := s.mgr.Upload(&s3manager.UploadInput{
-		Bucket:      nilString(bucketName),
-		Key:         nilString(prefix),
-		SSEKMSKeyId: nilString(s.cfg.KMSKeyID),
-		Body:        strings.NewReader(body),
+// objectURL returns the url of the object the way the s3 client addresses it.
+func (s *S3Uploader) objectURL(bucketName, key string) (string, error) {
+	req, _ := s.s3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: nilString(bucketName),
+		Key:    nilString(key),
 	})
-	if err != nil {
-		return "", &BucketError{Op: "upload template to s3", Bucket: bucketName, Err: err}
+
+	if err := req.Build(); err != nil {
+		return "", err
 	}
 
-	return r.Location, nil
+	return req.HTTPRequest.URL.String(), nil
 }
 
+// Cleanup removes the temporary bucket unless it's shared with the other
+// uploaders of the session.
 func (s S3Uploader) Cleanup() error {
-	if s.autoGeneratedBucket == "" {
+	if !s.ownsTmp {
 		return nil
 	}
 
-	// we don't care about paging as there is only one object in
-	// autogenerated bucket
+	return s.tmp.cleanup(s.s3)
+}
+
+// tmpBucket is the bucket created on the first upload when no bucket is
+// configured.
+type tmpBucket struct {
+	mu   sync.Mutex
+	name string
+}
+
+func (b *tmpBucket) ensure(create func(name string) error) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.name != "" {
+		return b.name, nil
+	}
+
+	name := fmt.Sprintf("%s%d", TmpBucketPrefix, time.Now().UnixNano())
+	if len(name) > bucketNameMaxLen {
+		name = name[:bucketNameMaxLen]
+	}
+
+	if err := create(name); err != nil {
+		return "", err
+	}
 
-	objects, err := s.s3.ListObjects(&s3.ListObjectsInput{Bucket: &s.autoGeneratedBucket})
+	b.name = name
+
+	return name, nil
+}
+
+func (b *tmpBucket) cleanup(s3api s3iface.S3API) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.name == "" {
+		return nil
+	}
+
+	if err := DeleteTmpBucket(s3api, b.name); err != nil {
+		return err
+	}
+
+	b.name = ""
+
+	return nil
+}
+
+// TmpBucket is a bucket that was created to upload templates.
+type TmpBucket struct {
+	Name         string
+	CreationDate time.Time
+}
+
+// ListTmpBuckets returns the buckets that were created to upload templates
+// and were not removed afterwards.
+func ListTmpBuckets(s3api s3iface.S3API) ([]TmpBucket, error) {
+	buckets := []TmpBucket{}
+
+	out, err := s3api.ListBuckets(&s3.ListBucketsInput{})
 	if err != nil {
-		return &BucketError{Op: "remove tmp s3 bucket", Bucket: s.autoGeneratedBucket, Err: err}
+		return buckets, fmt.Errorf("failed to list s3 buckets: %w", err)
 	}
 
-	ids := make([]*s3.ObjectIdentifier, 0, len(objects.Contents))
-	for _, obj := range objects.Contents {
-		ids = append(ids, &s3.ObjectIdentifier{Key: obj.Key})
+	for _, b := range out.Buckets {
+		if strings.HasPrefix(awssdk.StringValue(b.Name), TmpBucketPrefix) {
+			buckets = append(buckets, TmpBucket{
+				Name:         awssdk.StringValue(b.Name),
+				CreationDate: awssdk.TimeValue(b.CreationDate),
+			})
+		}
 	}
 
-	_, err = s.s3.DeleteObjects(&s3.DeleteObjectsInput{
-		Bucket: &s.autoGeneratedBucket,
-		Delete: &s3.Delete{Objects: ids},
-	})
+	return buckets, nil
+}
+
+// DeleteTmpBucket removes the bucket that was created to upload templates
+// together with its content.
+func DeleteTmpBucket(s3api s3iface.S3API, bucket string) error {
+	// we don't care about paging as there are only the templates of one run
+	// in autogenerated bucket
+
+	objects, err := s3api.ListObjects(&s3.ListObjectsInput{Bucket: &bucket})
 	if err != nil {
-		return &BucketError{Op: "remove tmp s3 bucket", Bucket: s.autoGeneratedBucket, Err: err}
+		return &BucketError{Op: "remove tmp s3 bucket", Bucket: bucket, Err: err}
 	}
 
-	_, err = s.s3.DeleteBucket(&s3.DeleteBucketInput{Bucket: &s.autoGeneratedBucket})
+	if len(objects.Contents) > 0 {
+		ids := make([]*s3.ObjectIdentifier, 0, len(objects.Contents))
+		for _, obj := range objects.Contents {
+			ids = append(ids, &s3.ObjectIdentifier{Key: obj.Key})
+		}
+
+		_, err = s3api.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: &bucket,
+			Delete: &s3.Delete{Objects: ids},
+		})
+		if err != nil {
+			return &BucketError{Op: "remove tmp s3 bucket", Bucket: bucket, Err: err}
+		}
+	}
+
+	_, err = s3api.DeleteBucket(&s3.DeleteBucketInput{Bucket: &bucket})
 	if err != nil {
-		return &BucketError{Op: "remove tmp s3 bucket", Bucket: s.autoGeneratedBucket, Err: err}
+		return &BucketError{Op: "remove tmp s3 bucket", Bucket: bucket, Err: err}
 	}
 
 	return nil
 }
 
+// Download returns the content of the template located by the url. S3 urls
+// (both https and s3:// ones) are fetched with s3 client, any other url is
+// fetched over http.
+func (s *S3Uploader) Download(rawurl string) (_ string, err error) {
+	defer errd.Wrapf(&err, "failed to download template from %s", rawurl)
+
+	bucket, key, ok := parseS3URL(rawurl)
+	if !ok {
+		return httpGet(rawurl)
+	}
+
+	obj, err := s.s3.GetObject(&s3.GetObjectInput{
+		Bucket: nilString(bucket),
+		Key:    nilString(key),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	defer obj.Body.Close()
+
+	buf, err := ioutil.ReadAll(obj.Body)
+
+	return string(buf), err
+}
+
+func parseS3URL(rawurl string) (bucket, key string, ok bool) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", false
+	}
+
+	path := strings.TrimPrefix(u.Path, "/")
+
+	if u.Scheme == "s3" {
+		return u.Host, path, true
+	}
+
+	m := s3HostRe.FindStringSubmatch(u.Hostname())
+	if m == nil {
+		return "", "", false
+	}
+
+	if m[1] != "" {
+		return m[1], path, true
+	}
+
+	// path-style url: https://s3.amazonaws.com/bucket/key
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+func httpGet(rawurl string) (string, error) {
+	resp, err := http.Get(rawurl) //nolint:gosec,noctx
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+
+	return string(buf), err
+}
+
 type S3UploadManager interface {
 	Upload(*s3manager.UploadInput, ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
 }
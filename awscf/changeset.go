@@ -16,6 +16,15 @@ import (
 	"github.com/molecule-man/stack-assembly/errd"
 )
 
+// ChangeSetNamePrefix is the prefix of the names of the change sets created
+// by stack-assembly.
+const ChangeSetNamePrefix = "chst-"
+
+const (
+	nestedStackType   = "AWS::CloudFormation::Stack"
+	serverlessAppType = "AWS::Serverless::Application"
+)
+
 type ChangeSet struct {
 	stack      *Stack
 	body       string
@@ -23,6 +32,9 @@ type ChangeSet struct {
 	parameters map[string]string
 	tags       map[string]string
 
+	// urlBody is the body downloaded from url. It's used only to show diff.
+	urlBody *string
+
 	input cloudformation.CreateChangeSetInput
 }
 
@@ -32,12 +44,111 @@ type Change struct {
 	ResourceType      string
 	LogicalResourceID string
 	ReplacementNeeded bool
+
+	// Replacement is one of True, False or Conditional. It's empty for
+	// added and removed resources.
+	Replacement string         `json:",omitempty"`
+	Scope       []string       `json:",omitempty"`
+	Details     []ChangeDetail `json:",omitempty"`
+
+	PhysicalResourceID string `json:",omitempty"`
+
+	// ChangeSetID is the ID of the nested change set. It's set only when the
+	// resource is a nested stack and the change set is created with nested
+	// stacks included.
+	ChangeSetID string   `json:",omitempty"`
+	Nested      []Change `json:",omitempty"`
+}
+
+// IsNestedStack returns true if the change is a change of a nested stack
+// which has its own change set.
+func (c Change) IsNestedStack() bool {
+	return c.ResourceType == nestedStackType && c.ChangeSetID != ""
+}
+
+// WalkChanges calls fn for every change including the changes of the nested
+// stacks. Depth is 0 for the changes of the root stack.
+func WalkChanges(changes []Change, fn func(c Change, depth int)) {
+	walkChanges(changes, 0, fn)
+}
+
+func walkChanges(changes []Change, depth int, fn func(c Change, depth int)) {
+	for _, c := range changes {
+		fn(c, depth)
+		walkChanges(c.Nested, depth+1, fn)
+	}
+}
+
+// ChangeDetail describes the change of a single property or attribute of a
+// resource and what caused the change.
+type ChangeDetail struct {
+	Attribute string
+	Name      string `json:",omitempty"`
+
+	// RequiresRecreation is one of Never, Conditionally or Always.
+	RequiresRecreation string `json:",omitempty"`
+	Evaluation         string `json:",omitempty"`
+	ChangeSource       string `json:",omitempty"`
+	CausingEntity      string `json:",omitempty"`
+}
+
+// Target returns the path of the changed property, e.g.
+// Properties.VisibilityTimeout.
+func (cd ChangeDetail) Target() string {
+	if cd.Name == "" {
+		return cd.Attribute
+	}
+
+	return cd.Attribute + "." + cd.Name
+}
+
+// Cause returns human readable description of what caused the change.
+func (cd ChangeDetail) Cause() string {
+	if cd.CausingEntity == "" {
+		return cd.ChangeSource
+	}
+
+	return cd.ChangeSource + ": " + cd.CausingEntity
 }
 
 func (cs *ChangeSet) Stack() *Stack {
 	return cs.stack
 }
 
+// UsesPreviousTemplate returns true if the change set reuses the template of
+// the deployed stack.
+func (cs *ChangeSet) UsesPreviousTemplate() bool {
+	return cs.url == "" && (cs.body == "" || aws.BoolValue(cs.input.UsePreviousTemplate))
+}
+
+// templateBody returns the body of the new template. The template referenced
+// by url is downloaded. Empty string is returned if the previous template is
+// used.
+func (cs *ChangeSet) templateBody() (string, error) {
+	if cs.url == "" {
+		if cs.UsesPreviousTemplate() {
+			return "", nil
+		}
+
+		return cs.body, nil
+	}
+
+	if cs.urlBody == nil {
+		if cs.stack.uploader == nil {
+			return "", fmt.Errorf("not able to download template from %s: s3 client is not configured", cs.url)
+		}
+
+		body, err := cs.stack.uploader.Download(cs.url)
+		if err != nil {
+			return "", err
+		}
+
+		cs.urlBody = &body
+	}
+
+	return *cs.urlBody, nil
+}
+
 func (cs *ChangeSet) WithTemplateURL(url string) *ChangeSet {
 	if url != "" {
 		cs.url = url
@@ -117,6 +228,7 @@ func (cs *ChangeSet) Register() (_ *ChangeSetHandle, err error) {
 	chSet := &ChangeSetHandle{
 		cf:        cs.stack.cf,
 		stackName: cs.stack.Name,
+		wait:      cs.stack.wait,
 	}
 
 	if err = cs.setupTplLocation(); err != nil {
@@ -139,11 +251,20 @@ func (cs *ChangeSet) Register() (_ *ChangeSetHandle, err error) {
 	}
 
 	cs.input.ChangeSetType = aws.String(operation)
-	cs.input.ChangeSetName = aws.String("chst-" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	cs.input.ChangeSetName = aws.String(ChangeSetNamePrefix + strconv.FormatInt(time.Now().UnixNano(), 10))
 	cs.input.StackName = aws.String(cs.stack.Name)
 	cs.input.Parameters = awsParams
 	cs.input.Tags = cs.awsTags()
 
+	nested, err := cs.hasNestedStacks()
+	if err != nil {
+		return chSet, err
+	}
+
+	if nested {
+		cs.input.IncludeNestedStacks = aws.Bool(true)
+	}
+
 	output, err := cs.stack.cf.CreateChangeSet(&cs.input)
 
 	if err != nil && strings.Contains(err.Error(), "IN_PROGRESS state and can not be updated") {
@@ -164,6 +285,30 @@ func (cs *ChangeSet) Register() (_ *ChangeSetHandle, err error) {
 	return chSet, chSet.loadChanges()
 }
 
+// hasNestedStacks checks if the template contains nested stacks. Change sets
+// for such templates are created with nested stacks included so the changes
+// of the nested stacks are visible as well. The template referenced by url is
+// downloaded to find it out.
+func (cs *ChangeSet) hasNestedStacks() (bool, error) {
+	body, err := cs.templateBody()
+	if err != nil || body == "" {
+		return false, err
+	}
+
+	types, err := TemplateResourceTypes(body)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	for _, typ := range types {
+		if typ == nestedStackType || typ == serverlessAppType {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func (cs *ChangeSet) setupTplLocation() (err error) {
 	defer errd.Wrapf(&err, "failed to setup template location")
 
@@ -177,7 +322,7 @@ func (cs *ChangeSet) setupTplLocation() (err error) {
 		return nil
 	}
 
-	url, err := cs.stack.uploader.Upload(cs.body)
+	url, err := cs.stack.uploader.Upload(cs.stack.Name, cs.body)
 	if err != nil {
 		return err
 	}
@@ -193,14 +338,18 @@ func (cs *ChangeSet) setupTplLocation() (err error) {
 }
 
 func (cs *ChangeSet) wait(id *string) error {
-	err := cs.stack.cf.WaitUntilChangeSetCreateCompleteWithContext(
-		aws.BackgroundContext(),
+	ws := cs.stack.wait.changeSetWaitSettings()
+
+	ctx, cancel := ws.waiterContext()
+	defer cancel()
+
+	err := ws.timeoutErr(ctx, cs.stack.cf.WaitUntilChangeSetCreateCompleteWithContext(
+		ctx,
 		&cloudformation.DescribeChangeSetInput{
 			ChangeSetName: id,
 		},
-		request.WithWaiterDelay(request.ConstantWaiterDelay(time.Second)),
-		request.WithWaiterMaxAttempts(120*30),
-	)
+		ws.waiterOptions(),
+	))
 
 	var aerr awserr.Error
 	if errors.As(err, &aerr) && aerr.Code() == request.WaiterResourceNotReadyErrorCode {
@@ -239,6 +388,8 @@ func (cs *ChangeSet) awsParameters() ([]*cloudformation.Parameter, error) {
 		input.TemplateURL = cs.input.TemplateURL
 	case cs.input.TemplateBody != nil:
 		input.TemplateBody = cs.input.TemplateBody
+	case cs.url != "":
+		input.TemplateURL = &cs.url
 	case cs.body != "":
 		input.TemplateBody = &cs.body
 	}
@@ -298,6 +449,7 @@ type ChangeSetHandle struct {
 	IsUpdate  bool
 	stackName string
 	cf        cloudformationiface.CloudFormationAPI
+	wait      WaitSettings
 }
 
 func (csh ChangeSetHandle) Exec() error {
@@ -312,31 +464,28 @@ func (csh ChangeSetHandle) Exec() error {
 		StackName: aws.String(csh.stackName),
 	}
 
-	ctx := aws.BackgroundContext()
+	ctx, cancel := csh.wait.waiterContext()
+	defer cancel()
 
 	if csh.IsUpdate {
-		return csh.cf.WaitUntilStackUpdateCompleteWithContext(ctx, &stackInput, func(w *request.Waiter) {
-			w.MaxAttempts = 900
-			w.Delay = request.ConstantWaiterDelay(2 * time.Second)
-		})
+		err = csh.cf.WaitUntilStackUpdateCompleteWithContext(ctx, &stackInput, csh.wait.waiterOptions())
+	} else {
+		err = csh.cf.WaitUntilStackCreateCompleteWithContext(ctx, &stackInput, csh.wait.waiterOptions())
 	}
 
-	return csh.cf.WaitUntilStackCreateCompleteWithContext(ctx, &stackInput, func(w *request.Waiter) {
-		w.MaxAttempts = 900
-		w.Delay = request.ConstantWaiterDelay(2 * time.Second)
-	})
+	return csh.wait.timeoutErr(ctx, err)
 }
 
 func (csh *ChangeSetHandle) loadChanges() error {
 	csh.Changes = make([]Change, 0)
-	return csh.changes(&csh.Changes, nil)
+	return csh.changes(csh.ID, &csh.Changes, nil)
 }
 
-func (csh ChangeSetHandle) changes(store *[]Change, nextToken *string) (err error) {
+func (csh ChangeSetHandle) changes(chSetID string, store *[]Change, nextToken *string) (err error) {
 	defer errd.Wrapf(&err, "failed to fetch stack changes")
 
 	setInfo, err := csh.cf.DescribeChangeSet(&cloudformation.DescribeChangeSetInput{
-		ChangeSetName: aws.String(csh.ID),
+		ChangeSetName: aws.String(chSetID),
 		NextToken:     nextToken,
 	})
 
@@ -355,20 +504,47 @@ func (csh ChangeSetHandle) changes(store *[]Change, nextToken *string) (err erro
 	for _, c := range setInfo.Changes {
 		awsChange := c.ResourceChange
 		ch := Change{
-			Action:            aws.StringValue(awsChange.Action),
-			ResourceType:      aws.StringValue(awsChange.ResourceType),
-			LogicalResourceID: aws.StringValue(awsChange.LogicalResourceId),
+			Action:             aws.StringValue(awsChange.Action),
+			ResourceType:       aws.StringValue(awsChange.ResourceType),
+			LogicalResourceID:  aws.StringValue(awsChange.LogicalResourceId),
+			PhysicalResourceID: aws.StringValue(awsChange.PhysicalResourceId),
+			ChangeSetID:        aws.StringValue(awsChange.ChangeSetId),
 		}
 
-		if aws.StringValue(awsChange.Replacement) == "True" {
+		if aws.StringValue(awsChange.Replacement) == cloudformation.ReplacementTrue {
 			ch.ReplacementNeeded = true
 		}
 
+		ch.Replacement = aws.StringValue(awsChange.Replacement)
+		ch.Scope = aws.StringValueSlice(awsChange.Scope)
+
+		for _, d := range awsChange.Details {
+			detail := ChangeDetail{
+				Evaluation:    aws.StringValue(d.Evaluation),
+				ChangeSource:  aws.StringValue(d.ChangeSource),
+				CausingEntity: aws.StringValue(d.CausingEntity),
+			}
+
+			if d.Target != nil {
+				detail.Attribute = aws.StringValue(d.Target.Attribute)
+				detail.Name = aws.StringValue(d.Target.Name)
+				detail.RequiresRecreation = aws.StringValue(d.Target.RequiresRecreation)
+			}
+
+			ch.Details = append(ch.Details, detail)
+		}
+
+		if ch.IsNestedStack() {
+			if err = csh.changes(ch.ChangeSetID, &ch.Nested, nil); err != nil && !errors.Is(err, ErrNoChange) {
+				return err
+			}
+		}
+
 		*store = append(*store, ch)
 	}
 
 	if aws.StringValue(setInfo.NextToken) != "" {
-		return csh.changes(store, setInfo.NextToken)
+		return csh.changes(chSetID, store, setInfo.NextToken)
 	}
 
 	return nil
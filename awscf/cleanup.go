@@ -0,0 +1,103 @@
+package awscf
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/molecule-man/stack-assembly/errd"
+)
+
+// Delete removes the change set. When the change set was created for a stack
+// that was not deployed yet, the stack left in REVIEW_IN_PROGRESS state is
+// removed as well.
+func (csh ChangeSetHandle) Delete() (err error) {
+	defer errd.Wrapf(&err, "failed to delete change set %s", csh.ID)
+
+	if csh.ID == "" {
+		return nil
+	}
+
+	_, err = csh.cf.DeleteChangeSet(&cloudformation.DeleteChangeSetInput{
+		ChangeSetName: aws.String(csh.ID),
+	})
+	if err != nil || csh.IsUpdate {
+		return err
+	}
+
+	stack := &Stack{Name: csh.stackName, cf: csh.cf}
+
+	info, err := stack.Info()
+	if errors.Is(err, ErrStackDoesntExist) {
+		return nil
+	}
+
+	if err != nil || !info.InReviewState() {
+		return err
+	}
+
+	_, err = csh.cf.DeleteStack(&cloudformation.DeleteStackInput{
+		StackName: aws.String(csh.stackName),
+	})
+
+	return err
+}
+
+// ChangeSetSummary contains info about the change set of the stack.
+type ChangeSetSummary struct {
+	ID              string
+	Name            string
+	StackName       string
+	Status          string
+	ExecutionStatus string
+	CreationTime    time.Time
+}
+
+// ListChangeSets returns the change sets of the stack.
+func ListChangeSets(cf cloudformationiface.CloudFormationAPI, stackName string) (_ []ChangeSetSummary, err error) {
+	defer errd.Wrapf(&err, "failed to list change sets of stack %s", stackName)
+
+	summaries := []ChangeSetSummary{}
+
+	return summaries, listChangeSets(cf, stackName, &summaries, nil)
+}
+
+func listChangeSets(cf cloudformationiface.CloudFormationAPI, stackName string, store *[]ChangeSetSummary, nextToken *string) error {
+	out, err := cf.ListChangeSets(&cloudformation.ListChangeSetsInput{
+		StackName: aws.String(stackName),
+		NextToken: nextToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range out.Summaries {
+		*store = append(*store, ChangeSetSummary{
+			ID:              aws.StringValue(s.ChangeSetId),
+			Name:            aws.StringValue(s.ChangeSetName),
+			StackName:       aws.StringValue(s.StackName),
+			Status:          aws.StringValue(s.Status),
+			ExecutionStatus: aws.StringValue(s.ExecutionStatus),
+			CreationTime:    aws.TimeValue(s.CreationTime),
+		})
+	}
+
+	if aws.StringValue(out.NextToken) != "" {
+		return listChangeSets(cf, stackName, store, out.NextToken)
+	}
+
+	return nil
+}
+
+// DeleteChangeSet removes the change set.
+func DeleteChangeSet(cf cloudformationiface.CloudFormationAPI, id string) (err error) {
+	defer errd.Wrapf(&err, "failed to delete change set %s", id)
+
+	_, err = cf.DeleteChangeSet(&cloudformation.DeleteChangeSetInput{
+		ChangeSetName: aws.String(id),
+	})
+
+	return err
+}
@@ -2,117 +2,449 @@ package awscf
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/molecule-man/stack-assembly/errd"
 	"github.com/pmezard/go-difflib/difflib"
-	"gopkg.in/yaml.v3"
 )
 
 const defaultDiffName = "/dev/null"
 
 type ChSetDiff struct {
 	Color cli.Color
+
+	// Unified switches the diff of the templates to the line based unified
+	// diff. By default the templates are compared structurally and only the
+	// changed nodes are shown.
+	Unified bool
 }
 
-func (d ChSetDiff) Diff(chSet *ChangeSet) (string, error) {
-	diffs := []string{}
+// DiffSection is a unified diff of one aspect of the stack, e.g. its
+// parameters, tags or template body.
+type DiffSection struct {
+	Name string
+	Diff string
+}
 
-	paramsDiff, err := diffParameters(chSet)
+func (d ChSetDiff) Diff(chSet *ChangeSet) (string, error) {
+	sections, err := d.Sections(chSet)
 	if err != nil {
 		return "", err
 	}
 
-	if len(paramsDiff) > 0 {
-		diffs = append(diffs, d.colorizeDiff(paramsDiff))
+	return d.RenderStack(chSet, sections), nil
+}
+
+// RenderStack renders the diff sections of the stack. When the stack reuses
+// the deployed template, it's reported explicitly that the template is not
+// changed.
+func (d ChSetDiff) RenderStack(chSet *ChangeSet, sections []DiffSection) string {
+	diff := d.Render(sections)
+
+	if !chSet.UsesPreviousTemplate() {
+		return diff
 	}
 
-	tagsDiff, err := diffTags(chSet)
+	note := d.Color.Cyan(fmt.Sprintf("Template of %s is unchanged (usePreviousTemplate)", chSet.Stack().Name))
+
+	if diff == "" {
+		return note
+	}
+
+	return diff + "\n" + note
+}
+
+// DiffNested returns diff of the templates of the nested stacks which change
+// sets belong to the registered change set.
+func (d ChSetDiff) DiffNested(chSet *ChangeSetHandle) (string, error) {
+	sections, err := d.NestedSections(chSet)
 	if err != nil {
 		return "", err
 	}
 
-	if len(tagsDiff) > 0 {
-		diffs = append(diffs, d.colorizeDiff(tagsDiff))
+	return d.Render(sections), nil
+}
+
+// Render joins the diff sections into one colorized diff.
+func (d ChSetDiff) Render(sections []DiffSection) string {
+	diffs := make([]string, 0, len(sections))
+
+	for _, s := range sections {
+		diffs = append(diffs, d.colorizeDiff(s.Diff))
 	}
 
-	bodyDiff, err := diffBody(chSet)
+	return strings.Join(diffs, "\n")
+}
+
+// sectionDiffer diffs one section of the stack. The info of the deployed
+// stack is nil if the stack is not deployed yet.
+type sectionDiffer struct {
+	name string
+	diff func(*ChangeSet, *StackInfo) (string, error)
+}
+
+// Sections returns uncolored diff sections of the stack. Sections without
+// changes are omitted.
+func (d ChSetDiff) Sections(chSet *ChangeSet) ([]DiffSection, error) {
+	sections := []DiffSection{}
+
+	info, err := deployedInfo(chSet)
 	if err != nil {
-		return "", err
+		return sections, err
+	}
+
+	differs := []sectionDiffer{
+		{"Parameters", diffParameters},
+		{"Tags", diffTags},
+	}
+
+	for _, setting := range stackSettings {
+		differs = append(differs, sectionDiffer{setting.name, setting.diff})
 	}
 
-	if len(bodyDiff) > 0 {
-		diffs = append(diffs, d.colorizeDiff(bodyDiff))
+	differs = append(differs, sectionDiffer{"Template", func(cs *ChangeSet, _ *StackInfo) (string, error) {
+		return d.diffBody(cs)
+	}})
+
+	for _, differ := range differs {
+		diff, err := differ.diff(chSet, info)
+		if err != nil {
+			return sections, err
+		}
+
+		if len(diff) > 0 {
+			sections = append(sections, DiffSection{Name: differ.name, Diff: diff})
+		}
 	}
 
-	return strings.Join(diffs, "\n"), nil
+	return sections, nil
 }
 
-func diffBody(chSet *ChangeSet) (string, error) {
-	if chSet.body == "" {
-		return "", nil
+// StackSetSections returns uncolored diff sections of the stack set:
+// parameters, tags, capabilities and template. Sections without changes are
+// omitted.
+func (d ChSetDiff) StackSetSections(plan StackSetPlan) ([]DiffSection, error) {
+	sections := []DiffSection{}
+
+	diffs := []struct {
+		name     string
+		kind     string
+		old, new []string
+	}{
+		{"Parameters", "parameters", valueLines(plan.oldParameters), valueLines(plan.newParameters)},
+		{"Tags", "tags", valueLines(plan.oldTags), valueLines(plan.newTags)},
+		{"Capabilities", "capabilities", lines(plan.oldCapabilities), lines(plan.newCapabilities)},
+	}
+
+	for _, v := range diffs {
+		oldName := defaultDiffName
+		if plan.Exists {
+			oldName = "old-" + v.kind + "/" + plan.name
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        v.old,
+			B:        v.new,
+			FromFile: oldName,
+			ToFile:   "new-" + v.kind + "/" + plan.name,
+			Context:  5,
+		})
+		if err != nil {
+			return sections, err
+		}
+
+		if diff != "" {
+			sections = append(sections, DiffSection{Name: v.name, Diff: diff})
+		}
 	}
 
-	oldBody := ""
 	oldName := defaultDiffName
+	if plan.Exists {
+		oldName = "old/" + plan.name
+	}
+
+	diff, err := d.diffBodies(oldName, plan.oldBody, "new/"+plan.name, plan.newBody)
+	if err != nil {
+		return sections, err
+	}
+
+	if diff != "" {
+		sections = append(sections, DiffSection{Name: "Template", Diff: diff})
+	}
+
+	return sections, nil
+}
+
+// valueLines renders the key-value pairs as diff lines sorted by key.
+func valueLines(vals map[string]string) []string {
+	ll := make([]string, 0, len(vals))
+	for _, k := range sortedKeys(vals) {
+		ll = append(ll, k+": "+vals[k]+"\n")
+	}
+
+	return ll
+}
+
+func lines(vals []string) []string {
+	ll := make([]string, 0, len(vals))
+	for _, v := range vals {
+		ll = append(ll, v+"\n")
+	}
+
+	return ll
+}
+
+// Actions of ValueChange.
+const (
+	ActionAdd    = "Add"
+	ActionModify = "Modify"
+	ActionRemove = "Remove"
+)
+
+// StackDiff is a structured representation of the differences between the
+// deployed stack and the stack that is about to be deployed.
+type StackDiff struct {
+	Stack      string
+	Parameters []ValueChange
+	Tags       []ValueChange
+
+	// Settings contains changes of the stack level settings: capabilities,
+	// role, notification ARNs and rollback configuration.
+	Settings []ValueChange
+
+	// Body is a diff of the template body. It's empty when the template is
+	// not changed.
+	Body string
+
+	// Template contains structural changes of the template.
+	Template []TemplateChange
+
+	// UsePreviousTemplate is true when the template of the deployed stack
+	// is reused, i.e. the template is not changed.
+	UsePreviousTemplate bool `json:",omitempty"`
+}
+
+// ValueChange is a change of a single key-value pair.
+type ValueChange struct {
+	Action string
+	Key    string
+	Old    string `json:",omitempty"`
+	New    string `json:",omitempty"`
+}
+
+// HasChanges returns true if the stack differs from the deployed one.
+func (sd StackDiff) HasChanges() bool {
+	return len(sd.Parameters) > 0 || len(sd.Tags) > 0 || len(sd.Settings) > 0 ||
+		sd.Body != "" || len(sd.Template) > 0
+}
+
+// StructuredDiff returns differences between the deployed stack and the
+// change set in a structured form.
+func (d ChSetDiff) StructuredDiff(chSet *ChangeSet) (_ StackDiff, err error) {
+	defer errd.Wrapf(&err, "failed to diff stack")
+
+	sd := StackDiff{Stack: chSet.Stack().Name, UsePreviousTemplate: chSet.UsesPreviousTemplate()}
+
+	oldParams := map[string]string{}
+	oldTags := map[string]string{}
 
 	deployed, err := chSet.Stack().AlreadyDeployed()
 	if err != nil {
-		return "", err
+		return sd, err
 	}
 
 	if deployed {
-		oldBody, err = chSet.Stack().Body()
+		info, ierr := chSet.Stack().Info()
+		if ierr != nil {
+			return sd, ierr
+		}
+
+		for _, p := range info.Parameters() {
+			oldParams[p.Key] = p.Val
+		}
+
+		for _, t := range info.Tags() {
+			oldTags[t.Key] = t.Val
+		}
+	}
+
+	awsParams, err := chSet.awsParameters()
+	if err != nil {
+		return sd, err
+	}
+
+	newParams := make(map[string]string, len(awsParams))
+
+	for _, p := range awsParams {
+		k := aws.StringValue(p.ParameterKey)
+
+		if aws.BoolValue(p.UsePreviousValue) {
+			newParams[k] = oldParams[k]
+			continue
+		}
+
+		newParams[k] = aws.StringValue(p.ParameterValue)
+	}
+
+	sd.Parameters = valueChanges(oldParams, newParams)
+	sd.Tags = valueChanges(oldTags, chSet.tags)
+
+	oldSettings := map[string]string{}
+	newSettings := map[string]string{}
+
+	var info *StackInfo
+
+	if deployed {
+		info, err = deployedInfo(chSet)
 		if err != nil {
-			return "", err
+			return sd, err
 		}
+	}
 
-		oldName = "old/" + chSet.Stack().Name
+	for _, setting := range stackSettings {
+		oldLines, newLines := setting.lines(chSet, info)
+
+		if len(oldLines) > 0 {
+			oldSettings[setting.name] = strings.Join(oldLines, ", ")
+		}
+
+		if len(newLines) > 0 {
+			newSettings[setting.name] = strings.Join(newLines, ", ")
+		}
 	}
 
-	var (
-		oldBodyRaw interface{}
-		bodyRaw    interface{}
-	)
+	sd.Settings = valueChanges(oldSettings, newSettings)
 
-	newBodyBytes := []byte(chSet.body)
-	oldBodyBytes := []byte(oldBody)
-	oldBodyYAML := false
-	oldBodyJSON := false
-	newBodyYAML := false
+	sd.Body, err = d.diffBody(chSet)
+	if err != nil || chSet.UsesPreviousTemplate() {
+		return sd, err
+	}
 
-	if oldBody != "" {
-		jsonErr := json.Unmarshal(oldBodyBytes, &oldBodyRaw)
-		oldBodyJSON = jsonErr == nil
+	oldBody, err := deployedBody(chSet)
+	if err != nil {
+		return sd, err
+	}
+
+	newBody, err := chSet.templateBody()
+	if err != nil {
+		return sd, err
+	}
+
+	sd.Template, err = DiffTemplates(oldBody, newBody)
+
+	return sd, err
+}
 
-		if !oldBodyJSON {
-			yamlErr := yaml.Unmarshal(oldBodyBytes, &oldBodyRaw)
-			oldBodyYAML = yamlErr == nil
+func valueChanges(oldVals, newVals map[string]string) []ValueChange {
+	changes := []ValueChange{}
+
+	for k, newVal := range newVals {
+		oldVal, ok := oldVals[k]
+
+		switch {
+		case !ok:
+			changes = append(changes, ValueChange{Action: ActionAdd, Key: k, New: newVal})
+		case oldVal != newVal:
+			changes = append(changes, ValueChange{Action: ActionModify, Key: k, Old: oldVal, New: newVal})
+		}
+	}
+
+	for k, oldVal := range oldVals {
+		if _, ok := newVals[k]; !ok {
+			changes = append(changes, ValueChange{Action: ActionRemove, Key: k, Old: oldVal})
 		}
 	}
 
-	jsonErr := json.Unmarshal(newBodyBytes, &bodyRaw)
-	newBodyJSON := jsonErr == nil
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+
+	return changes
+}
+
+func (d ChSetDiff) diffBody(chSet *ChangeSet) (string, error) {
+	if chSet.UsesPreviousTemplate() {
+		return "", nil
+	}
 
-	if !newBodyJSON {
-		yamlErr := yaml.Unmarshal(newBodyBytes, &bodyRaw)
-		newBodyYAML = yamlErr == nil
+	newBody, err := chSet.templateBody()
+	if err != nil {
+		return "", err
 	}
 
-	if newBodyYAML && oldBodyYAML && reflect.DeepEqual(bodyRaw, oldBodyRaw) {
+	oldBody, err := deployedBody(chSet)
+	if err != nil {
+		return "", err
+	}
+
+	oldName := defaultDiffName
+	if oldBody != "" {
+		oldName = "old/" + chSet.Stack().Name
+	}
+
+	return d.diffBodies(oldName, oldBody, "new/"+chSet.Stack().Name, newBody)
+}
+
+func deployedBody(chSet *ChangeSet) (string, error) {
+	deployed, err := chSet.Stack().AlreadyDeployed()
+	if err != nil || !deployed {
+		return "", err
+	}
+
+	return chSet.Stack().Body()
+}
+
+func (d ChSetDiff) diffBodies(oldName, oldBody, newName, newBody string) (string, error) {
+	if d.Unified {
+		return unifiedBodiesDiff(oldName, oldBody, newName, newBody)
+	}
+
+	changes, err := DiffTemplates(oldBody, newBody)
+	if err != nil || len(changes) == 0 {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(changes)+2)
+	lines = append(lines, "--- "+oldName, "+++ "+newName)
+
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func unifiedBodiesDiff(oldName, oldBody, newName, newBody string) (_ string, err error) {
+	var oldTpl, newTpl interface{}
+
+	oldBodyBytes := []byte(oldBody)
+	newBodyBytes := []byte(newBody)
+	oldParsed := false
+
+	if oldBody != "" {
+		var parseErr error
+		oldTpl, parseErr = ParseTemplate(oldBody)
+		oldParsed = parseErr == nil
+	}
+
+	newTpl, parseErr := ParseTemplate(newBody)
+
+	if oldParsed && parseErr == nil && reflect.DeepEqual(oldTpl, newTpl) {
 		return "", nil
 	}
 
-	if newBodyJSON || oldBodyJSON {
-		newBodyBytes, err = json.MarshalIndent(bodyRaw, "", "  ")
+	if json.Valid(oldBodyBytes) || json.Valid(newBodyBytes) {
+		newBodyBytes, err = json.MarshalIndent(newTpl, "", "  ")
 		if err != nil {
 			return "", err
 		}
 
-		oldBodyBytes, err = json.MarshalIndent(oldBodyRaw, "", "  ")
+		oldBodyBytes, err = json.MarshalIndent(oldTpl, "", "  ")
 		if err != nil {
 			return "", err
 		}
@@ -123,13 +455,59 @@ func diffBody(chSet *ChangeSet) (string, error) {
 		B:        difflib.SplitLines(strings.TrimSpace(string(newBodyBytes))),
 		FromFile: oldName,
 		FromDate: "",
-		ToFile:   "new/" + chSet.Stack().Name,
+		ToFile:   newName,
 		ToDate:   "",
 		Context:  5,
 	})
 }
 
-func diffParameters(chSet *ChangeSet) (string, error) {
+// NestedSections returns diffs of the templates of the nested stacks which
+// change sets belong to the registered change set.
+func (d ChSetDiff) NestedSections(chSet *ChangeSetHandle) (_ []DiffSection, err error) {
+	defer errd.Wrapf(&err, "failed to diff nested stacks")
+
+	sections := []DiffSection{}
+
+	WalkChanges(chSet.Changes, func(c Change, _ int) {
+		if err != nil || !c.IsNestedStack() {
+			return
+		}
+
+		var diff string
+
+		diff, err = d.diffNestedTemplate(chSet.cf, c)
+		if err == nil && diff != "" {
+			sections = append(sections, DiffSection{Name: "Template of " + c.LogicalResourceID, Diff: diff})
+		}
+	})
+
+	return sections, err
+}
+
+func (d ChSetDiff) diffNestedTemplate(cf cloudformationiface.CloudFormationAPI, c Change) (string, error) {
+	tpl, err := cf.GetTemplate(&cloudformation.GetTemplateInput{
+		ChangeSetName: aws.String(c.ChangeSetID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	oldBody := ""
+	oldName := defaultDiffName
+
+	if c.Action != ActionAdd && c.PhysicalResourceID != "" {
+		oldBody, err = (&Stack{Name: c.PhysicalResourceID, cf: cf}).Body()
+		if err != nil {
+			return "", err
+		}
+
+		oldName = "old/" + c.LogicalResourceID
+	}
+
+	return d.diffBodies(oldName, oldBody, "new/"+c.LogicalResourceID, aws.StringValue(tpl.TemplateBody))
+}
+
+func diffParameters(chSet *ChangeSet, info *StackInfo) (string, error) {
 	awsParams, err := chSet.awsParameters()
 	if err != nil {
 		return "", err
@@ -145,17 +523,7 @@ func diffParameters(chSet *ChangeSet) (string, error) {
 	oldName := defaultDiffName
 	oldParams := []string{}
 
-	deployed, err := chSet.Stack().AlreadyDeployed()
-	if err != nil {
-		return "", err
-	}
-
-	if deployed {
-		info, err := chSet.Stack().Info()
-		if err != nil {
-			return "", err
-		}
-
+	if info != nil {
 		oldName = "old-parameters/" + chSet.Stack().Name
 		oldParams = make([]string, 0, len(info.Parameters()))
 
@@ -175,7 +543,7 @@ func diffParameters(chSet *ChangeSet) (string, error) {
 	})
 }
 
-func diffTags(chSet *ChangeSet) (string, error) {
+func diffTags(chSet *ChangeSet, info *StackInfo) (string, error) {
 	newTags := make([]string, 0, len(chSet.tags))
 
 	for k, v := range chSet.tags {
@@ -185,17 +553,7 @@ func diffTags(chSet *ChangeSet) (string, error) {
 	oldName := defaultDiffName
 	oldTags := []string{}
 
-	deployed, err := chSet.Stack().AlreadyDeployed()
-	if err != nil {
-		return "", err
-	}
-
-	if deployed {
-		info, err := chSet.Stack().Info()
-		if err != nil {
-			return "", err
-		}
-
+	if info != nil {
 		oldName = "old-tags/" + chSet.Stack().Name
 		oldTags = make([]string, 0, len(info.Tags()))
 
@@ -229,7 +587,7 @@ func (d ChSetDiff) colorizeDiff(diff string) string {
 		switch {
 		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
 			colorized[i] = d.Color.Yellow(line)
-		case strings.HasPrefix(line, "@@"):
+		case strings.HasPrefix(line, "@@"), strings.HasPrefix(line, "~ "):
 			colorized[i] = d.Color.Cyan(line)
 		case strings.HasPrefix(line, "+"):
 			colorized[i] = d.Color.Green(line)
@@ -240,3 +598,157 @@ func (d ChSetDiff) colorizeDiff(diff string) string {
 
 	return strings.Join(colorized, "\n")
 }
+
+// stackSetting is a stack level setting that is compared with the one of the
+// deployed stack.
+type stackSetting struct {
+	name string
+	kind string
+
+	deployed   func(StackInfo) []string
+	configured func(*ChangeSet) []string
+
+	// keptIfOmitted is true when cloudformation keeps the deployed value of
+	// the setting if it's not provided in the change set.
+	keptIfOmitted bool
+}
+
+var stackSettings = []stackSetting{
+	{
+		name: "Capabilities",
+		kind: "capabilities",
+		deployed: func(info StackInfo) []string {
+			return info.Capabilities()
+		},
+		configured: func(cs *ChangeSet) []string {
+			return aws.StringValueSlice(cs.input.Capabilities)
+		},
+	},
+	{
+		name: "Role",
+		kind: "role",
+		deployed: func(info StackInfo) []string {
+			return nonEmptyLines(info.RoleARN())
+		},
+		configured: func(cs *ChangeSet) []string {
+			return nonEmptyLines(aws.StringValue(cs.input.RoleARN))
+		},
+		keptIfOmitted: true,
+	},
+	{
+		name: "Notifications",
+		kind: "notifications",
+		deployed: func(info StackInfo) []string {
+			return info.NotificationARNs()
+		},
+		configured: func(cs *ChangeSet) []string {
+			return aws.StringValueSlice(cs.input.NotificationARNs)
+		},
+		keptIfOmitted: true,
+	},
+	{
+		name: "Rollback configuration",
+		kind: "rollback-configuration",
+		deployed: func(info StackInfo) []string {
+			return rollbackLines(info.RollbackConfiguration())
+		},
+		configured: func(cs *ChangeSet) []string {
+			return rollbackLines(cs.input.RollbackConfiguration)
+		},
+		keptIfOmitted: true,
+	},
+}
+
+// lines returns the setting of the deployed stack and the one of the change
+// set as sorted lines. info is nil if the stack is not deployed yet.
+func (s stackSetting) lines(chSet *ChangeSet, info *StackInfo) (oldLines, newLines []string) {
+	oldLines = []string{}
+	newLines = s.configured(chSet)
+
+	if info != nil {
+		oldLines = s.deployed(*info)
+
+		if s.keptIfOmitted && len(newLines) == 0 {
+			newLines = oldLines
+		}
+	}
+
+	oldLines = append([]string{}, oldLines...)
+	newLines = append([]string{}, newLines...)
+
+	sort.Strings(oldLines)
+	sort.Strings(newLines)
+
+	return oldLines, newLines
+}
+
+func (s stackSetting) diff(chSet *ChangeSet, info *StackInfo) (string, error) {
+	oldLines, newLines := s.lines(chSet, info)
+
+	oldName := defaultDiffName
+	if info != nil {
+		oldName = "old-" + s.kind + "/" + chSet.Stack().Name
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        withNewLines(oldLines),
+		B:        withNewLines(newLines),
+		FromFile: oldName,
+		FromDate: "",
+		ToFile:   "new-" + s.kind + "/" + chSet.Stack().Name,
+		ToDate:   "",
+		Context:  5,
+	})
+}
+
+// deployedInfo returns the info of the deployed stack or nil if the stack is
+// not deployed yet.
+func deployedInfo(chSet *ChangeSet) (*StackInfo, error) {
+	deployed, err := chSet.Stack().AlreadyDeployed()
+	if err != nil || !deployed {
+		return nil, err
+	}
+
+	info, err := chSet.Stack().Info()
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func nonEmptyLines(val string) []string {
+	if val == "" {
+		return []string{}
+	}
+
+	return []string{val}
+}
+
+func rollbackLines(rollbackCfg *cloudformation.RollbackConfiguration) []string {
+	lines := []string{}
+
+	if rollbackCfg == nil {
+		return lines
+	}
+
+	if rollbackCfg.MonitoringTimeInMinutes != nil {
+		lines = append(lines, fmt.Sprintf("MonitoringTimeInMinutes: %d", aws.Int64Value(rollbackCfg.MonitoringTimeInMinutes)))
+	}
+
+	for _, t := range rollbackCfg.RollbackTriggers {
+		lines = append(lines, fmt.Sprintf("RollbackTrigger: %s (%s)", aws.StringValue(t.Arn), aws.StringValue(t.Type)))
+	}
+
+	return lines
+}
+
+func withNewLines(lines []string) []string {
+	res := make([]string, 0, len(lines))
+
+	for _, l := range lines {
+		res = append(res, l+"\n")
+	}
+
+	return res
+}
@@ -2,16 +2,22 @@ package awscf
 
 import (
 	"errors"
+	"io/ioutil"
 	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	saAws "github.com/molecule-man/stack-assembly/aws"
 	"github.com/molecule-man/stack-assembly/cli"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestDiffWhenStackExists(t *testing.T) {
-	d := ChSetDiff{cli.Color{Disabled: true}}
+	d := ChSetDiff{Color: cli.Color{Disabled: true}, Unified: true}
 	oldTplBody := `
 parameters:
   param1: old_val1
@@ -41,7 +47,7 @@ parameters:
 }
 
 func TestDiffWhenStackDoesntExist(t *testing.T) {
-	d := ChSetDiff{cli.Color{Disabled: true}}
+	d := ChSetDiff{Color: cli.Color{Disabled: true}, Unified: true}
 	newTplBody := `
 parameters:
   param1: val1
@@ -65,3 +71,164 @@ parameters:
 `
 	assert.Equal(t, strings.TrimSpace(expected), strings.TrimSpace(diff))
 }
+
+func TestStructuredDiff(t *testing.T) {
+	cf := &cfMock{}
+	cf.body = "Resources: {}"
+	cf.templateParameters = []*cloudformation.TemplateParameter{
+		{ParameterKey: aws.String("foo")},
+		{ParameterKey: aws.String("bar")},
+	}
+	chSet := NewStack("teststack", cf, nil).
+		ChangeSet("Resources: {}").
+		WithParameter("foo", "fooval").
+		WithParameter("bar", "barval").
+		WithTags(map[string]string{"env": "dev"})
+
+	diff, err := ChSetDiff{}.StructuredDiff(chSet)
+	require.NoError(t, err)
+
+	expected := StackDiff{
+		Stack: "teststack",
+		Parameters: []ValueChange{
+			{Action: ActionAdd, Key: "bar", New: "barval"},
+			{Action: ActionAdd, Key: "foo", New: "fooval"},
+		},
+		Tags: []ValueChange{
+			{Action: ActionAdd, Key: "env", New: "dev"},
+		},
+		Settings: []ValueChange{},
+		Template: []TemplateChange{},
+	}
+
+	assert.Equal(t, expected, diff)
+	assert.True(t, diff.HasChanges())
+}
+
+func TestStructuralTemplateDiff(t *testing.T) {
+	d := ChSetDiff{Color: cli.Color{Disabled: true}}
+
+	cf := &cfMock{}
+	cf.body = `
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      VisibilityTimeout: 10`
+	chSet := NewStack("teststack", cf, nil).ChangeSet(`
+Resources:
+  Queue:
+    Properties:
+      VisibilityTimeout: 20
+    Type: AWS::SQS::Queue`)
+
+	diff, err := d.Diff(chSet)
+	require.NoError(t, err)
+
+	expected := `
+--- old/teststack
++++ new/teststack
+~ Resources.Queue.Properties.VisibilityTimeout: 10 → 20
+`
+	assert.Equal(t, strings.TrimSpace(expected), strings.TrimSpace(diff))
+}
+
+func TestDiffOfStackSettings(t *testing.T) {
+	d := ChSetDiff{Color: cli.Color{Disabled: true}}
+
+	cf := &cfMock{}
+	cf.body = "Resources: {}"
+	cf.stack = &cloudformation.Stack{
+		StackStatus:      aws.String(cloudformation.StackStatusUpdateComplete),
+		Capabilities:     aws.StringSlice([]string{"CAPABILITY_IAM"}),
+		RoleARN:          aws.String("arn:aws:iam::123:role/old"),
+		NotificationARNs: aws.StringSlice([]string{"arn:aws:sns:eu-west-1:123:topic"}),
+	}
+
+	chSet := NewStack("teststack", cf, nil).
+		ChangeSet("Resources: {}").
+		WithCapabilities([]string{"CAPABILITY_IAM", "CAPABILITY_AUTO_EXPAND"}).
+		WithRoleARN("arn:aws:iam::123:role/new").
+		WithRollback(&cloudformation.RollbackConfiguration{MonitoringTimeInMinutes: aws.Int64(5)})
+
+	sections, err := d.Sections(chSet)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, s := range sections {
+		names = append(names, s.Name)
+	}
+
+	assert.Equal(t, []string{"Capabilities", "Role", "Rollback configuration"}, names)
+	assert.Contains(t, sections[0].Diff, "+CAPABILITY_AUTO_EXPAND")
+	assert.Contains(t, sections[1].Diff, "-arn:aws:iam::123:role/old\n+arn:aws:iam::123:role/new")
+	assert.Contains(t, sections[2].Diff, "+MonitoringTimeInMinutes: 5")
+
+	sd, err := d.StructuredDiff(chSet)
+	require.NoError(t, err)
+	assert.Equal(t, []ValueChange{
+		{Action: ActionModify, Key: "Capabilities", Old: "CAPABILITY_IAM", New: "CAPABILITY_AUTO_EXPAND, CAPABILITY_IAM"},
+		{Action: ActionModify, Key: "Role", Old: "arn:aws:iam::123:role/old", New: "arn:aws:iam::123:role/new"},
+		{Action: ActionAdd, Key: "Rollback configuration", New: "MonitoringTimeInMinutes: 5"},
+	}, sd.Settings)
+}
+
+type s3GetObjectMock struct {
+	s3iface.S3API
+	objects map[string]string
+}
+
+func (m s3GetObjectMock) GetObject(inp *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	body, ok := m.objects[aws.StringValue(inp.Bucket)+"/"+aws.StringValue(inp.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestDiffOfTemplateFromURL(t *testing.T) {
+	d := ChSetDiff{Color: cli.Color{Disabled: true}}
+
+	cf := &cfMock{}
+	cf.body = "Resources: {Topic: {Type: AWS::SNS::Topic}}"
+
+	uploader := saAws.NewS3Uploader(s3Mock{}, s3GetObjectMock{objects: map[string]string{
+		"my-bucket/tpls/stack.yaml": "Resources: {Queue: {Type: AWS::SQS::Queue}}",
+	}}, saAws.S3Settings{})
+
+	for _, url := range []string{
+		"s3://my-bucket/tpls/stack.yaml",
+		"https://my-bucket.s3.eu-west-1.amazonaws.com/tpls/stack.yaml",
+		"https://s3.amazonaws.com/my-bucket/tpls/stack.yaml",
+	} {
+		chSet := NewStack("teststack", cf, uploader).ChangeSet("").WithTemplateURL(url)
+
+		diff, err := d.Diff(chSet)
+		require.NoError(t, err, url)
+
+		expected := `
+--- old/teststack
++++ new/teststack
++ Resources.Queue: {"Type":"AWS::SQS::Queue"}
+- Resources.Topic: {"Type":"AWS::SNS::Topic"}
+`
+		assert.Equal(t, strings.TrimSpace(expected), strings.TrimSpace(diff), url)
+	}
+}
+
+func TestDiffReportsPreviousTemplate(t *testing.T) {
+	d := ChSetDiff{Color: cli.Color{Disabled: true}}
+
+	cf := &cfMock{}
+	cf.body = "Resources: {}"
+	chSet := NewStack("teststack", cf, nil).ChangeSet("").WithUsePrevTpl(true)
+
+	diff, err := d.Diff(chSet)
+	require.NoError(t, err)
+	assert.Equal(t, "Template of teststack is unchanged (usePreviousTemplate)", diff)
+
+	sections, err := d.Sections(chSet)
+	require.NoError(t, err)
+	assert.Empty(t, sections)
+}
@@ -1,45 +1,140 @@
 package awscf
 
+import (
+	"sync"
+	"time"
+)
+
+// EventsTrack keeps track of the stack events that are already seen. It
+// remembers the timestamp of the newest seen event (the watermark) together
+// with the IDs of the events having this timestamp, so that the memory it
+// uses doesn't grow with the number of events.
 type EventsTrack struct {
+	mu    sync.Mutex
 	stack *Stack
 
-	seenEvents      map[string]bool
+	watermark       time.Time
+	watermarkIDs    map[string]bool
 	trackingStarted bool
 }
 
+// FreshEvents returns the events that appeared since the previous call. The
+// first call only sets the watermark and returns no events. The events are
+// paginated until the already seen events are reached, so no event is lost
+// even if many of them appeared between the calls.
 func (et *EventsTrack) FreshEvents() (StackEvents, error) {
-	emptyEvents := StackEvents{}
+	et.mu.Lock()
+	defer et.mu.Unlock()
 
-	// IMPORTANT: newer events appear at the beginning of a slice
-	events, err := et.stack.Events()
-	if err != nil {
-		return emptyEvents, err
+	if !et.trackingStarted {
+		// IMPORTANT: newer events appear at the beginning of a slice
+		events, err := et.stack.Events()
+		if err != nil {
+			return StackEvents{}, err
+		}
+
+		et.watermarkIDs = map[string]bool{}
+		et.advanceWatermark(events)
+		et.trackingStarted = true
+
+		return StackEvents{}, nil
 	}
 
-	if !et.trackingStarted {
-		et.seenEvents = make(map[string]bool, len(events))
+	freshEvents := StackEvents{}
+
+	var nextToken *string
+
+	for {
+		events, token, err := et.stack.eventsPage(nextToken)
+		if err != nil {
+			return StackEvents{}, err
+		}
+
+		reachedSeen := false
 
 		for _, e := range events {
-			et.seenEvents[e.ID] = true
+			if e.Timestamp.Before(et.watermark) {
+				reachedSeen = true
+				break
+			}
+
+			if e.Timestamp.Equal(et.watermark) && et.watermarkIDs[e.ID] {
+				continue
+			}
+
+			freshEvents = append(freshEvents, e)
 		}
 
-		et.trackingStarted = true
+		if reachedSeen || token == nil {
+			break
+		}
 
-		return emptyEvents, nil
+		nextToken = token
 	}
 
-	if len(events) == 0 {
-		return emptyEvents, nil
-	}
+	et.advanceWatermark(freshEvents)
 
-	freshEvents := make(StackEvents, 0, len(events))
+	return freshEvents, nil
+}
 
+func (et *EventsTrack) advanceWatermark(events StackEvents) {
 	for _, e := range events {
-		if _, ok := et.seenEvents[e.ID]; !ok {
-			freshEvents = append(freshEvents, e)
-			et.seenEvents[e.ID] = true
+		switch {
+		case e.Timestamp.After(et.watermark):
+			et.watermark = e.Timestamp
+			et.watermarkIDs = map[string]bool{e.ID: true}
+		case e.Timestamp.Equal(et.watermark):
+			et.watermarkIDs[e.ID] = true
 		}
 	}
+}
 
-	return freshEvents, nil
+// StreamEvents polls the events of the stack every interval and passes the
+// fresh ones to handle in chronological order. handle is called after every
+// successful poll, even if there are no fresh events, so that it can be used to
+// refresh the views that depend on time. Errors of polling are passed to
+// handleErr. The returned stop function makes the last poll, so that the
+// events emitted right before the stack operation is complete are delivered
+// too, and returns when the stream is finished.
+func (s *Stack) StreamEvents(interval time.Duration, handle func(StackEvents), handleErr func(error)) (stop func()) {
+	poll := func() {
+		events, err := s.EventsTrack().FreshEvents()
+		if err != nil {
+			handleErr(err)
+			return
+		}
+
+		handle(events.Reversed())
+	}
+
+	poll()
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				poll()
+				return
+			case <-ticker.C:
+				poll()
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			<-done
+		})
+	}
 }
@@ -0,0 +1,165 @@
+package awscf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxFailureDepth limits how deep nested stacks are followed while looking
+// for the root cause of the failure.
+const maxFailureDepth = 5
+
+// Failure is a failed event that caused the stack operation to fail.
+type Failure struct {
+	// StackName is the name of the stack the event belongs to. It differs
+	// from the name of the deployed stack when the failure happened in a
+	// nested stack.
+	StackName string
+	Event     StackEvent
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("[%s] %s (%s) %s: %s",
+		f.StackName, f.Event.LogicalResourceID, f.Event.ResourceType, f.Event.Status, f.Event.StatusReason)
+}
+
+// FailureError is returned when the stack operation fails. Besides the error
+// of the operation it contains the root causes of the failure. The root
+// causes are not part of the error message, FailureReport renders them.
+type FailureError struct {
+	Err      error
+	Failures []Failure
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+// FailureReport renders the root causes of the failure.
+func FailureReport(failures []Failure) string {
+	lines := make([]string, 0, len(failures)+1)
+	lines = append(lines, "Root cause of the failure:")
+
+	for _, f := range failures {
+		lines = append(lines, "  "+f.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RootCauses returns the first failed events of the latest operation of the
+// stack. When the failed resource is a nested stack, the failures are looked
+// up in the events of the nested stack.
+func (s *Stack) RootCauses() ([]Failure, error) {
+	return rootCauses(s, s.Name, 0)
+}
+
+func rootCauses(s *Stack, stackName string, depth int) ([]Failure, error) {
+	events, err := s.operationEvents(stackName)
+	if err != nil {
+		return []Failure{}, err
+	}
+
+	failed := []StackEvent{}
+	cancelled := []StackEvent{}
+
+	// IMPORTANT: newer events appear at the beginning of a slice
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+
+		if isStackSelfEvent(e, stackName) || !strings.HasSuffix(e.Status, "_FAILED") {
+			continue
+		}
+
+		// resources that are cancelled because of the failure of other
+		// resources are not the cause
+		if strings.Contains(e.StatusReason, "cancelled") {
+			cancelled = append(cancelled, e)
+			continue
+		}
+
+		failed = append(failed, e)
+	}
+
+	if len(failed) == 0 {
+		failed = cancelled
+	}
+
+	failures := []Failure{}
+
+	for _, e := range failed {
+		if e.ResourceType == nestedStackType && e.PhysicalResourceID != "" && depth < maxFailureDepth {
+			nestedName := stackNameFromID(e.PhysicalResourceID)
+			nested := NewStack(e.PhysicalResourceID, s.cf, nil)
+
+			nestedFailures, err := rootCauses(nested, nestedName, depth+1)
+			if err != nil {
+				return failures, err
+			}
+
+			if len(nestedFailures) > 0 {
+				failures = append(failures, nestedFailures...)
+				continue
+			}
+		}
+
+		failures = append(failures, Failure{StackName: stackName, Event: e})
+	}
+
+	return failures, nil
+}
+
+// operationEvents returns the events of the latest operation of the stack.
+// The events are paginated until the event that starts the operation is
+// reached.
+func (s *Stack) operationEvents(stackName string) (StackEvents, error) {
+	events := StackEvents{}
+
+	var nextToken *string
+
+	for {
+		page, token, err := s.eventsPage(nextToken)
+		if err != nil {
+			return events, err
+		}
+
+		for _, e := range page {
+			events = append(events, e)
+
+			if isStackSelfEvent(e, stackName) && isOperationStart(e.Status) {
+				return events, nil
+			}
+		}
+
+		if token == nil {
+			return events, nil
+		}
+
+		nextToken = token
+	}
+}
+
+func isStackSelfEvent(e StackEvent, stackName string) bool {
+	return e.ResourceType == nestedStackType && e.LogicalResourceID == stackName
+}
+
+func isOperationStart(status string) bool {
+	return strings.HasSuffix(status, "_IN_PROGRESS") &&
+		!strings.Contains(status, "ROLLBACK") &&
+		!strings.Contains(status, "CLEANUP")
+}
+
+// stackNameFromID extracts the name of the stack from its ARN, e.g.
+// arn:aws:cloudformation:eu-west-1:123456789012:stack/name/uuid.
+func stackNameFromID(id string) string {
+	parts := strings.Split(id, "/")
+	if len(parts) == 3 {
+		return parts[1]
+	}
+
+	return id
+}
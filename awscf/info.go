@@ -37,6 +37,15 @@ func (si StackInfo) ID() string {
 	return aws.StringValue(si.awsStack.StackId)
 }
 
+func (si StackInfo) Name() string {
+	return aws.StringValue(si.awsStack.StackName)
+}
+
+// ParentID returns the ID of the parent stack if the stack is nested.
+func (si StackInfo) ParentID() string {
+	return aws.StringValue(si.awsStack.ParentId)
+}
+
 func (si StackInfo) AlreadyDeployed() bool {
 	return !si.InReviewState()
 }
@@ -49,10 +58,30 @@ func (si StackInfo) Status() string {
 	return aws.StringValue(si.awsStack.StackStatus)
 }
 
+func (si StackInfo) CreationTime() time.Time {
+	return aws.TimeValue(si.awsStack.CreationTime)
+}
+
 func (si StackInfo) StatusDescription() string {
 	return aws.StringValue(si.awsStack.StackStatusReason)
 }
 
+func (si StackInfo) Capabilities() []string {
+	return aws.StringValueSlice(si.awsStack.Capabilities)
+}
+
+func (si StackInfo) RoleARN() string {
+	return aws.StringValue(si.awsStack.RoleARN)
+}
+
+func (si StackInfo) NotificationARNs() []string {
+	return aws.StringValueSlice(si.awsStack.NotificationARNs)
+}
+
+func (si StackInfo) RollbackConfiguration() *cloudformation.RollbackConfiguration {
+	return si.awsStack.RollbackConfiguration
+}
+
 func (si StackInfo) Parameters() []KeyVal {
 	parameters := make([]KeyVal, 0, len(si.awsStack.Parameters))
 
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 	saAws "github.com/molecule-man/stack-assembly/aws"
@@ -19,12 +18,13 @@ const noChangeStatus = "The submitted information didn't contain changes. " +
 
 // StackEvent is a stack event.
 type StackEvent struct {
-	ID                string
-	ResourceType      string
-	Status            string
-	LogicalResourceID string
-	StatusReason      string
-	Timestamp         time.Time
+	ID                 string
+	ResourceType       string
+	Status             string
+	LogicalResourceID  string
+	PhysicalResourceID string
+	StatusReason       string
+	Timestamp          time.Time
 }
 
 type StackEvents []StackEvent
@@ -51,12 +51,49 @@ type Stack struct {
 	uploader    *saAws.S3Uploader
 	cachedInfo  *StackInfo
 	eventsTrack *EventsTrack
+	wait        WaitSettings
 }
 
 func NewStack(name string, cf cloudformationiface.CloudFormationAPI, uploader *saAws.S3Uploader) *Stack {
 	return &Stack{Name: name, cf: cf, uploader: uploader}
 }
 
+// WithWaitSettings sets how long and how often the stack operations are
+// waited for.
+func (s *Stack) WithWaitSettings(ws WaitSettings) *Stack {
+	s.wait = ws
+	return s
+}
+
+// ListStacks returns info about all the stacks that exist in the account and
+// region the client is configured for.
+func ListStacks(cf cloudformationiface.CloudFormationAPI) (_ []StackInfo, err error) {
+	defer errd.Wrapf(&err, "failed to list stacks")
+
+	infos := []StackInfo{}
+
+	return infos, listStacks(cf, &infos, nil)
+}
+
+func listStacks(cf cloudformationiface.CloudFormationAPI, store *[]StackInfo, nextToken *string) error {
+	out, err := cf.DescribeStacks(&cloudformation.DescribeStacksInput{
+		NextToken: nextToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range out.Stacks {
+		*store = append(*store, StackInfo{awsStack: s})
+	}
+
+	if aws.StringValue(out.NextToken) != "" {
+		return listStacks(cf, store, out.NextToken)
+	}
+
+	return nil
+}
+
 func (s *Stack) Info() (_ StackInfo, err error) {
 	defer errd.Wrapf(&err, "failed to fetch stack info from aws")
 
@@ -140,12 +177,13 @@ func (s *Stack) Delete() error {
 	waitInput := cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Name),
 	}
-	ctx := aws.BackgroundContext()
 
-	return s.cf.WaitUntilStackDeleteCompleteWithContext(ctx, &waitInput, func(w *request.Waiter) {
-		w.MaxAttempts = 900
-		w.Delay = request.ConstantWaiterDelay(2 * time.Second)
-	})
+	ctx, cancel := s.wait.waiterContext()
+	defer cancel()
+
+	err = s.cf.WaitUntilStackDeleteCompleteWithContext(ctx, &waitInput, s.wait.waiterOptions())
+
+	return s.wait.timeoutErr(ctx, err)
 }
 
 func (s *Stack) Wait() (err error) {
@@ -158,28 +196,27 @@ func (s *Stack) Wait() (err error) {
 
 	info.Status()
 
-	ctx := aws.BackgroundContext()
 	waitInput := cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Name),
 	}
-	waiter := func(w *request.Waiter) {
-		w.MaxAttempts = 900
-		w.Delay = request.ConstantWaiterDelay(2 * time.Second)
-	}
+	waiter := s.wait.waiterOptions()
 
 	if !strings.HasSuffix(info.Status(), "IN_PROGRESS") {
 		return fmt.Errorf("stack is in state that can't be waited for: %s", info.Status())
 	}
 
+	ctx, cancel := s.wait.waiterContext()
+	defer cancel()
+
 	switch {
 	case strings.Contains(info.Status(), "ROLLBACK"):
-		return s.cf.WaitUntilStackRollbackCompleteWithContext(ctx, &waitInput, waiter)
+		return s.wait.timeoutErr(ctx, s.cf.WaitUntilStackRollbackCompleteWithContext(ctx, &waitInput, waiter))
 	case strings.Contains(info.Status(), "UPDATE"):
-		return s.cf.WaitUntilStackUpdateCompleteWithContext(ctx, &waitInput, waiter)
+		return s.wait.timeoutErr(ctx, s.cf.WaitUntilStackUpdateCompleteWithContext(ctx, &waitInput, waiter))
 	case strings.Contains(info.Status(), "CREATE"):
-		return s.cf.WaitUntilStackCreateCompleteWithContext(ctx, &waitInput, waiter)
+		return s.wait.timeoutErr(ctx, s.cf.WaitUntilStackCreateCompleteWithContext(ctx, &waitInput, waiter))
 	case strings.Contains(info.Status(), "DELETE"):
-		return s.cf.WaitUntilStackDeleteCompleteWithContext(ctx, &waitInput, waiter)
+		return s.wait.timeoutErr(ctx, s.cf.WaitUntilStackDeleteCompleteWithContext(ctx, &waitInput, waiter))
 	}
 
 	return fmt.Errorf("stack is in state that can't be waited for: %s", info.Status())
@@ -259,29 +296,42 @@ func (s *Stack) Resources() ([]StackResource, error) {
 	return resources, nil
 }
 
+// Events returns the most recent events of the stack (the first page of
+// DescribeStackEvents). Newer events appear at the beginning of the slice.
 func (s *Stack) Events() ([]StackEvent, error) {
+	events, _, err := s.eventsPage(nil)
+	return events, err
+}
+
+func (s *Stack) eventsPage(nextToken *string) ([]StackEvent, *string, error) {
 	awsEvents, err := s.cf.DescribeStackEvents(&cloudformation.DescribeStackEventsInput{
 		StackName: aws.String(s.Name),
+		NextToken: nextToken,
 	})
 
 	if err != nil {
-		return []StackEvent{}, err
+		return []StackEvent{}, nil, err
 	}
 
 	events := make([]StackEvent, len(awsEvents.StackEvents))
 
 	for i, e := range awsEvents.StackEvents {
 		events[i] = StackEvent{
-			ID:                aws.StringValue(e.EventId),
-			ResourceType:      aws.StringValue(e.ResourceType),
-			Status:            aws.StringValue(e.ResourceStatus),
-			LogicalResourceID: aws.StringValue(e.LogicalResourceId),
-			StatusReason:      aws.StringValue(e.ResourceStatusReason),
-			Timestamp:         aws.TimeValue(e.Timestamp),
+			ID:                 aws.StringValue(e.EventId),
+			ResourceType:       aws.StringValue(e.ResourceType),
+			Status:             aws.StringValue(e.ResourceStatus),
+			LogicalResourceID:  aws.StringValue(e.LogicalResourceId),
+			PhysicalResourceID: aws.StringValue(e.PhysicalResourceId),
+			StatusReason:       aws.StringValue(e.ResourceStatusReason),
+			Timestamp:          aws.TimeValue(e.Timestamp),
 		}
 	}
 
-	return events, nil
+	if aws.StringValue(awsEvents.NextToken) == "" {
+		return events, nil, nil
+	}
+
+	return events, awsEvents.NextToken, nil
 }
 
 func (s *Stack) EventsTrack() *EventsTrack {
@@ -2,6 +2,7 @@ package awscf
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -73,7 +74,7 @@ func TestEventTracking(t *testing.T) {
 			wg.Wait()
 			return nil
 		},
-		describeStackEventsFunc: func() (*cloudformation.DescribeStackEventsOutput, error) {
+		describeStackEventsFunc: func(*cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
 			mu.Lock()
 			defer mu.Unlock()
 			return &cloudformation.DescribeStackEventsOutput{
@@ -86,6 +87,13 @@ func TestEventTracking(t *testing.T) {
 	cs, err := stack.ChangeSet("body").Register()
 	require.NoError(t, err)
 
+	capturedEvents := []StackEvent{}
+	stop := stack.StreamEvents(time.Millisecond, func(events StackEvents) {
+		capturedEvents = append(capturedEvents, events...)
+	}, func(err error) {
+		assert.NoError(t, err)
+	})
+
 	wg.Add(1)
 
 	go func() {
@@ -99,42 +107,258 @@ func TestEventTracking(t *testing.T) {
 		wg.Done()
 	}()
 
-	stop := make(chan bool)
-	captured := make(chan StackEvent, 1000)
+	require.NoError(t, cs.Exec())
+	stop()
 
-	go track(t, stack, captured, stop)
+	expected := []StackEvent{{ID: "4"}, {ID: "5"}, {ID: "6"}}
 
-	require.NoError(t, cs.Exec())
-	stop <- true
+	assert.Equal(t, expected, capturedEvents)
+}
 
-	capturedEvents := []StackEvent{}
+func TestEventTrackingPaginatesUntilSeenEvent(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(id string, sec int) *cloudformation.StackEvent {
+		return &cloudformation.StackEvent{EventId: aws.String(id), Timestamp: aws.Time(ts.Add(time.Duration(sec) * time.Second))}
+	}
 
-	for e := range captured {
-		capturedEvents = append(capturedEvents, e)
+	pages := [][]*cloudformation.StackEvent{{event("1", 0)}}
+
+	cf := &cfMock{
+		describeStackEventsFunc: func(inp *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+			page := 0
+			if inp.NextToken != nil {
+				fmt.Sscan(*inp.NextToken, &page)
+			}
+
+			out := &cloudformation.DescribeStackEventsOutput{StackEvents: pages[page]}
+			if page+1 < len(pages) {
+				out.NextToken = aws.String(fmt.Sprint(page + 1))
+			}
+
+			return out, nil
+		},
 	}
 
-	expected := []StackEvent{{ID: "4"}, {ID: "5"}, {ID: "6"}}
+	track := NewStack("mystack", cf, s3Uploader()).EventsTrack()
 
-	assert.Equal(t, expected, capturedEvents)
+	events, err := track.FreshEvents()
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	pages = [][]*cloudformation.StackEvent{
+		{event("5", 3), event("4", 2)},
+		{event("3", 1), event("2", 1)},
+		{event("1", 0)},
+		{event("0", -1)},
+	}
+
+	events, err = track.FreshEvents()
+	require.NoError(t, err)
+
+	ids := []string{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	assert.Equal(t, []string{"5", "4", "3", "2"}, ids)
+
+	events, err = track.FreshEvents()
+	require.NoError(t, err)
+	assert.Empty(t, events)
 }
 
-func track(t *testing.T, stack *Stack, eventsCh chan<- StackEvent, cancel <-chan bool) {
-	for {
-		events, err := stack.EventsTrack().FreshEvents()
+func TestRootCausesFollowNestedStacks(t *testing.T) {
+	nestedID := "arn:aws:cloudformation:eu-west-1:123456789012:stack/mystack-Db-1/uuid"
+	event := func(id, resourceType, status, reason string) *cloudformation.StackEvent {
+		return &cloudformation.StackEvent{
+			LogicalResourceId:    aws.String(id),
+			ResourceType:         aws.String(resourceType),
+			ResourceStatus:       aws.String(status),
+			ResourceStatusReason: aws.String(reason),
+		}
+	}
+
+	events := map[string][]*cloudformation.StackEvent{
+		"mystack": {
+			event("mystack", "AWS::CloudFormation::Stack", "UPDATE_ROLLBACK_IN_PROGRESS", "The following resource(s) failed to update: [Db]"),
+			event("Queue", "AWS::SQS::Queue", "UPDATE_FAILED", "Resource update cancelled"),
+			{
+				LogicalResourceId:  aws.String("Db"),
+				PhysicalResourceId: aws.String(nestedID),
+				ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+				ResourceStatus:     aws.String("UPDATE_FAILED"),
+			},
+			event("mystack", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", "User Initiated"),
+			event("Old", "AWS::SQS::Queue", "CREATE_FAILED", "failure of previous operation"),
+		},
+		nestedID: {
+			event("Instance", "AWS::RDS::DBInstance", "UPDATE_FAILED", "invalid instance class"),
+			event("mystack-Db-1", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS", ""),
+		},
+	}
+
+	cf := &cfMock{
+		describeStackEventsFunc: func(inp *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+			return &cloudformation.DescribeStackEventsOutput{StackEvents: events[aws.StringValue(inp.StackName)]}, nil
+		},
+	}
+
+	failures, err := NewStack("mystack", cf, s3Uploader()).RootCauses()
+	require.NoError(t, err)
+
+	require.Len(t, failures, 1)
+	assert.Equal(t, "mystack-Db-1", failures[0].StackName)
+	assert.Equal(t, "Instance", failures[0].Event.LogicalResourceID)
+
+	err = &FailureError{Err: errors.New("waiter failed"), Failures: failures}
+	assert.Equal(t, "waiter failed", err.Error())
+	assert.Equal(t, "Root cause of the failure:\n"+
+		"  [mystack-Db-1] Instance (AWS::RDS::DBInstance) UPDATE_FAILED: invalid instance class", FailureReport(failures))
+}
+
+func TestChangeDetailsAreLoaded(t *testing.T) {
+	cf := &cfMock{}
+	cf.changes = []*cloudformation.Change{{
+		ResourceChange: &cloudformation.ResourceChange{
+			Action:            aws.String("Modify"),
+			ResourceType:      aws.String("AWS::RDS::DBInstance"),
+			LogicalResourceId: aws.String("Db"),
+			Replacement:       aws.String("Conditional"),
+			Scope:             aws.StringSlice([]string{"Properties"}),
+			Details: []*cloudformation.ResourceChangeDetail{{
+				ChangeSource:  aws.String("ParameterReference"),
+				CausingEntity: aws.String("DbClass"),
+				Evaluation:    aws.String("Static"),
+				Target: &cloudformation.ResourceTargetDefinition{
+					Attribute:          aws.String("Properties"),
+					Name:               aws.String("DBInstanceClass"),
+					RequiresRecreation: aws.String("Conditionally"),
+				},
+			}},
+		},
+	}}
+
+	chSet, err := NewStack("mystack", cf, s3Uploader()).ChangeSet("body").Register()
+	require.NoError(t, err)
+	require.Len(t, chSet.Changes, 1)
+
+	ch := chSet.Changes[0]
+	assert.False(t, ch.ReplacementNeeded)
+	assert.Equal(t, "Conditional", ch.Replacement)
+	assert.Equal(t, []string{"Properties"}, ch.Scope)
+	require.Len(t, ch.Details, 1)
+	assert.Equal(t, "Properties.DBInstanceClass", ch.Details[0].Target())
+	assert.Equal(t, "Conditionally", ch.Details[0].RequiresRecreation)
+	assert.Equal(t, "ParameterReference: DbClass", ch.Details[0].Cause())
+}
+
+func TestNestedStackChanges(t *testing.T) {
+	cf := &cfMock{}
+	cf.changes = []*cloudformation.Change{{
+		ResourceChange: &cloudformation.ResourceChange{
+			Action:             aws.String("Modify"),
+			ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+			LogicalResourceId:  aws.String("Nested"),
+			PhysicalResourceId: aws.String("nested-stack-arn"),
+			ChangeSetId:        aws.String("nested-chst"),
+		},
+	}}
+	cf.nestedChanges = map[string][]*cloudformation.Change{
+		"nested-chst": {{
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String("Add"),
+				ResourceType:      aws.String("AWS::SQS::Queue"),
+				LogicalResourceId: aws.String("Queue"),
+			},
+		}},
+	}
+	cf.body = "Resources:\n  Topic:\n    Type: AWS::SNS::Topic"
+	cf.nestedTemplates = map[string]string{
+		"nested-chst": "Resources:\n  Queue:\n    Type: AWS::SQS::Queue",
+	}
+
+	body := "Resources:\n  Nested:\n    Type: AWS::CloudFormation::Stack"
+	chSet, err := NewStack("mystack", cf, s3Uploader()).ChangeSet(body).Register()
+	require.NoError(t, err)
+
+	assert.True(t, aws.BoolValue(cf.createChangeSetInput.IncludeNestedStacks))
+
+	visited := []string{}
+	WalkChanges(chSet.Changes, func(c Change, depth int) {
+		visited = append(visited, fmt.Sprintf("%d:%s", depth, c.LogicalResourceID))
+	})
+	assert.Equal(t, []string{"0:Nested", "1:Queue"}, visited)
+
+	sections, err := ChSetDiff{}.NestedSections(chSet)
+	require.NoError(t, err)
+	require.Len(t, sections, 1)
+	assert.Equal(t, "Template of Nested", sections[0].Name)
+	assert.Contains(t, sections[0].Diff, `- Resources.Topic: {"Type":"AWS::SNS::Topic"}`)
+	assert.Contains(t, sections[0].Diff, `+ Resources.Queue: {"Type":"AWS::SQS::Queue"}`)
+}
+
+func TestNestedStacksAreDetectedByResourceType(t *testing.T) {
+	uploader := saAws.NewS3Uploader(s3Mock{}, s3GetObjectMock{objects: map[string]string{
+		"my-bucket/nested.yaml": "Resources: {Nested: {Type: AWS::CloudFormation::Stack}}",
+		"my-bucket/plain.yaml":  "Resources: {Queue: {Type: AWS::SQS::Queue}}",
+	}}, saAws.S3Settings{})
+
+	cases := []struct {
+		body     string
+		url      string
+		expected bool
+	}{
+		{body: "Resources:\n  Nested:\n    Type: AWS::CloudFormation::Stack", expected: true},
+		{body: "Description: AWS::CloudFormation::Stack\nResources: {}", expected: false},
+		{url: "s3://my-bucket/nested.yaml", expected: true},
+		{url: "s3://my-bucket/plain.yaml", expected: false},
+	}
+
+	for _, tc := range cases {
+		cf := &cfMock{}
+
+		_, err := NewStack("mystack", cf, uploader).ChangeSet(tc.body).WithTemplateURL(tc.url).Register()
 		require.NoError(t, err)
 
-		for _, e := range events.Reversed() {
-			eventsCh <- e
-		}
+		assert.Equal(t, tc.expected, aws.BoolValue(cf.createChangeSetInput.IncludeNestedStacks), tc.body+tc.url)
+	}
+}
 
-		select {
-		case <-cancel:
-			close(eventsCh)
-			return
-		default:
-			time.Sleep(6 * time.Millisecond)
-		}
+func TestChangeSetDeletion(t *testing.T) {
+	cases := []struct {
+		stackStatus   string
+		deletedStacks []string
+	}{
+		{cloudformation.StackStatusReviewInProgress, []string{"mystack"}},
+		{cloudformation.StackStatusCreateComplete, nil},
+	}
+
+	for _, tc := range cases {
+		cf := &cfMock{stackStatus: tc.stackStatus}
+
+		chSet := ChangeSetHandle{ID: "chst-1", stackName: "mystack", cf: cf}
+		require.NoError(t, chSet.Delete())
+
+		assert.Equal(t, []string{"chst-1"}, cf.deletedChangeSets)
+		assert.Equal(t, tc.deletedStacks, cf.deletedStacks)
+	}
+}
+
+func TestListChangeSetsFollowsPagination(t *testing.T) {
+	cf := &cfMock{changeSetPages: [][]*cloudformation.ChangeSetSummary{
+		{{ChangeSetName: aws.String("chst-1"), StackName: aws.String("mystack")}},
+		{{ChangeSetName: aws.String("chst-2"), StackName: aws.String("mystack")}},
+	}}
+
+	summaries, err := ListChangeSets(cf, "mystack")
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, s := range summaries {
+		names = append(names, s.Name)
 	}
+
+	assert.Equal(t, []string{"chst-1", "chst-2"}, names)
 }
 
 type cfMock struct {
@@ -151,10 +375,21 @@ type cfMock struct {
 	waitChSetErr  error
 	describeErr   error
 
-	body string
+	body        string
+	stackStatus string
+	stack       *cloudformation.Stack
+	changes     []*cloudformation.Change
+
+	changeSetPages [][]*cloudformation.ChangeSetSummary
+
+	nestedChanges   map[string][]*cloudformation.Change
+	nestedTemplates map[string]string
+
+	deletedChangeSets []string
+	deletedStacks     []string
 
 	waitStackFunc           func() error
-	describeStackEventsFunc func() (*cloudformation.DescribeStackEventsOutput, error)
+	describeStackEventsFunc func(*cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error)
 }
 
 func (cf *cfMock) ValidateTemplate(*cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
@@ -166,27 +401,44 @@ func (cf *cfMock) ValidateTemplate(*cloudformation.ValidateTemplateInput) (*clou
 
 func (cf *cfMock) DescribeStacks(*cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
 	out := cloudformation.DescribeStacksOutput{
-		Stacks: []*cloudformation.Stack{{}},
+		Stacks: []*cloudformation.Stack{{StackStatus: aws.String(cf.stackStatus)}},
+	}
+
+	if cf.stack != nil {
+		out.Stacks = []*cloudformation.Stack{cf.stack}
 	}
 
 	return &out, cf.describeErr
 }
-func (cf *cfMock) GetTemplate(*cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+func (cf *cfMock) GetTemplateSummary(*cloudformation.GetTemplateSummaryInput) (*cloudformation.GetTemplateSummaryOutput, error) {
+	return &cloudformation.GetTemplateSummaryOutput{}, cf.err
+}
+
+func (cf *cfMock) GetTemplate(inp *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
 	out := cloudformation.GetTemplateOutput{}
 	out.TemplateBody = aws.String(cf.body)
 
+	if tpl, ok := cf.nestedTemplates[aws.StringValue(inp.ChangeSetName)]; ok {
+		out.TemplateBody = aws.String(tpl)
+	}
+
 	return &out, cf.err
 }
 
-func (cf *cfMock) DescribeChangeSet(*cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+func (cf *cfMock) DescribeChangeSet(inp *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
 	out := cloudformation.DescribeChangeSetOutput{}
 	out.Status = aws.String("")
+	out.Changes = cf.changes
+
+	if nested, ok := cf.nestedChanges[aws.StringValue(inp.ChangeSetName)]; ok {
+		out.Changes = nested
+	}
 
 	return &out, cf.changesErr
 }
 func (cf *cfMock) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
 	if cf.describeStackEventsFunc != nil {
-		return cf.describeStackEventsFunc()
+		return cf.describeStackEventsFunc(input)
 	}
 
 	return &cloudformation.DescribeStackEventsOutput{}, cf.err
@@ -216,6 +468,30 @@ func (cf *cfMock) WaitUntilStackUpdateCompleteWithContext(aws.Context, *cloudfor
 	return nil
 }
 
+func (cf *cfMock) DeleteChangeSet(inp *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	cf.deletedChangeSets = append(cf.deletedChangeSets, aws.StringValue(inp.ChangeSetName))
+	return &cloudformation.DeleteChangeSetOutput{}, cf.err
+}
+
+func (cf *cfMock) DeleteStack(inp *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	cf.deletedStacks = append(cf.deletedStacks, aws.StringValue(inp.StackName))
+	return &cloudformation.DeleteStackOutput{}, cf.err
+}
+
+func (cf *cfMock) ListChangeSets(inp *cloudformation.ListChangeSetsInput) (*cloudformation.ListChangeSetsOutput, error) {
+	page := 0
+	if inp.NextToken != nil {
+		fmt.Sscan(*inp.NextToken, &page)
+	}
+
+	out := &cloudformation.ListChangeSetsOutput{Summaries: cf.changeSetPages[page]}
+	if page+1 < len(cf.changeSetPages) {
+		out.NextToken = aws.String(fmt.Sprint(page + 1))
+	}
+
+	return out, cf.err
+}
+
 func s3Uploader() *saAws.S3Uploader {
 	return saAws.NewS3Uploader(s3Mock{}, nil, saAws.S3Settings{})
 }
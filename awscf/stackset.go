@@ -0,0 +1,755 @@
+package awscf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	saAws "github.com/molecule-man/stack-assembly/aws"
+	"github.com/molecule-man/stack-assembly/errd"
+)
+
+// ErrStackSetDoesntExist is returned when the stack set is not created yet.
+var ErrStackSetDoesntExist = errors.New("stack set doesn't exist")
+
+// StackSetSettings are the settings of the stack set and of its instances.
+type StackSetSettings struct {
+	// PermissionModel is either SELF_MANAGED (the default) or
+	// SERVICE_MANAGED. The instances of self-managed stack sets are deployed
+	// to accounts, the ones of service-managed stack sets to organizational
+	// units.
+	PermissionModel       string                                       `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	AdministrationRoleARN string                                       `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	ExecutionRoleName     string                                       `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	AutoDeployment        *cloudformation.AutoDeployment               `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	DeploymentTargets     DeploymentTargets                            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	OperationPreferences  *cloudformation.StackSetOperationPreferences `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	// RemoveDroppedInstances makes sync delete the instances that are no
+	// longer listed in the deployment targets. RetainStacks keeps the stacks
+	// of the deleted instances.
+	RemoveDroppedInstances bool `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	RetainStacks           bool `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+// DeploymentTargets are the accounts or organizational units and the regions
+// the instances of the stack set are deployed to. One instance is deployed
+// per account (or organizational unit) and region.
+type DeploymentTargets struct {
+	Accounts            []string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	OrganizationalUnits []string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Regions             []string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+func (s StackSetSettings) serviceManaged() bool {
+	return s.PermissionModel == cloudformation.PermissionModelsServiceManaged
+}
+
+// units returns the accounts or the organizational units the instances are
+// deployed to depending on the permission model.
+func (s StackSetSettings) units() []string {
+	if s.serviceManaged() {
+		return s.DeploymentTargets.OrganizationalUnits
+	}
+
+	return s.DeploymentTargets.Accounts
+}
+
+// StackSet is the stack set described by the template, parameters and
+// settings given by the With* methods.
+type StackSet struct {
+	Name string
+
+	cf       cloudformationiface.CloudFormationAPI
+	uploader *saAws.S3Uploader
+	wait     WaitSettings
+
+	body         string
+	url          string
+	parameters   map[string]string
+	tags         map[string]string
+	capabilities []string
+	settings     StackSetSettings
+}
+
+func NewStackSet(name string, cf cloudformationiface.CloudFormationAPI, uploader *saAws.S3Uploader) *StackSet {
+	return &StackSet{Name: name, cf: cf, uploader: uploader}
+}
+
+// WithWaitSettings sets how long and how often the stack set operations are
+// waited for.
+func (ss *StackSet) WithWaitSettings(ws WaitSettings) *StackSet {
+	ss.wait = ws
+	return ss
+}
+
+func (ss *StackSet) WithTemplate(body, url string) *StackSet {
+	ss.body = body
+	ss.url = url
+
+	return ss
+}
+
+func (ss *StackSet) WithParameters(parameters map[string]string) *StackSet {
+	ss.parameters = parameters
+	return ss
+}
+
+func (ss *StackSet) WithTags(tags map[string]string) *StackSet {
+	ss.tags = tags
+	return ss
+}
+
+func (ss *StackSet) WithCapabilities(capabilities []string) *StackSet {
+	ss.capabilities = capabilities
+	return ss
+}
+
+func (ss *StackSet) WithSettings(settings StackSetSettings) *StackSet {
+	ss.settings = settings
+	return ss
+}
+
+// Close removes the template uploaded to s3.
+func (ss *StackSet) Close() error {
+	if ss.uploader == nil {
+		return nil
+	}
+
+	return ss.uploader.Cleanup()
+}
+
+// StackInstance is an instance of the stack set deployed to the account and
+// region.
+type StackInstance struct {
+	Account            string
+	OrganizationalUnit string `json:",omitempty"`
+	Region             string
+	Status             string
+	StatusReason       string `json:",omitempty"`
+}
+
+// InstanceBatch is a group of instances that are created or deleted by one
+// operation: one instance per target and region. Targets are either
+// accounts or organizational units depending on the permission model.
+type InstanceBatch struct {
+	Targets []string
+	Regions []string
+}
+
+func (b InstanceBatch) String() string {
+	return fmt.Sprintf("targets: %s, regions: %s", strings.Join(b.Targets, ", "), strings.Join(b.Regions, ", "))
+}
+
+// StackSetPlan describes what sync of the stack set is going to change.
+type StackSetPlan struct {
+	// Exists is false if the stack set is going to be created.
+	Exists bool
+	// Update is true if the template, parameters, tags or capabilities of
+	// the existing stack set differ from the configured ones. The templates
+	// are compared structurally, so the ones that differ only in formatting
+	// are considered equal.
+	Update bool
+
+	Create []InstanceBatch
+	Delete []InstanceBatch
+
+	name string
+
+	oldBody, newBody                 string
+	oldParameters, newParameters     map[string]string
+	oldTags, newTags                 map[string]string
+	oldCapabilities, newCapabilities []string
+}
+
+// HasChanges returns true if sync of the stack set has anything to do.
+func (p StackSetPlan) HasChanges() bool {
+	return !p.Exists || p.Update || len(p.Create) > 0 || len(p.Delete) > 0
+}
+
+// Plan compares the configured stack set with the deployed one.
+func (ss *StackSet) Plan() (_ StackSetPlan, err error) {
+	defer errd.Wrapf(&err, "failed to plan changes of stack set %s", ss.Name)
+
+	plan := StackSetPlan{
+		name:            ss.Name,
+		newParameters:   nonNilMap(ss.parameters),
+		newTags:         nonNilMap(ss.tags),
+		newCapabilities: sortedCopy(ss.capabilities),
+		oldParameters:   map[string]string{},
+		oldTags:         map[string]string{},
+		oldCapabilities: []string{},
+	}
+
+	units := ss.settings.units()
+	if len(units) == 0 && ss.settings.serviceManaged() {
+		return plan, errors.New("deployment targets must list organizational units of the SERVICE_MANAGED stack set")
+	}
+
+	if len(units) == 0 {
+		return plan, errors.New("deployment targets must list accounts of the SELF_MANAGED stack set")
+	}
+
+	if plan.newBody, err = ss.templateBody(); err != nil {
+		return plan, err
+	}
+
+	deployed, err := ss.describe()
+	if errors.Is(err, ErrStackSetDoesntExist) {
+		plan.Create = instanceBatches(instanceKeys(units, ss.settings.DeploymentTargets.Regions))
+		return plan, nil
+	}
+
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Exists = true
+	plan.oldBody = aws.StringValue(deployed.TemplateBody)
+	plan.oldCapabilities = sortedCopy(aws.StringValueSlice(deployed.Capabilities))
+
+	for _, p := range deployed.Parameters {
+		plan.oldParameters[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	for _, t := range deployed.Tags {
+		plan.oldTags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	tplChanges, err := DiffTemplates(plan.oldBody, plan.newBody)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Update = len(tplChanges) > 0 ||
+		len(valueChanges(plan.oldParameters, plan.newParameters)) > 0 ||
+		len(valueChanges(plan.oldTags, plan.newTags)) > 0 ||
+		strings.Join(plan.oldCapabilities, ",") != strings.Join(plan.newCapabilities, ",")
+
+	instances, err := ss.Instances()
+	if err != nil {
+		return plan, err
+	}
+
+	existing := make([]instanceKey, 0, len(instances))
+
+	for _, i := range instances {
+		unit := i.Account
+		if ss.settings.serviceManaged() {
+			unit = i.OrganizationalUnit
+		}
+
+		existing = append(existing, instanceKey{unit, i.Region})
+	}
+
+	create, remove := diffInstances(instanceKeys(units, ss.settings.DeploymentTargets.Regions), existing)
+	plan.Create = instanceBatches(create)
+
+	if ss.settings.RemoveDroppedInstances {
+		plan.Delete = instanceBatches(remove)
+	}
+
+	return plan, nil
+}
+
+func (ss *StackSet) templateBody() (string, error) {
+	if ss.url == "" {
+		return ss.body, nil
+	}
+
+	if ss.uploader == nil {
+		return "", errors.New("can't download template: s3 uploader is not configured")
+	}
+
+	return ss.uploader.Download(ss.url)
+}
+
+func (ss *StackSet) describe() (*cloudformation.StackSet, error) {
+	out, err := ss.cf.DescribeStackSet(&cloudformation.DescribeStackSetInput{
+		StackSetName: aws.String(ss.Name),
+	})
+
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == cloudformation.ErrCodeStackSetNotFoundException {
+		return nil, ErrStackSetDoesntExist
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out.StackSet, nil
+}
+
+// Instances returns the deployed instances of the stack set.
+func (ss *StackSet) Instances() (_ []StackInstance, err error) {
+	defer errd.Wrapf(&err, "failed to list instances of stack set %s", ss.Name)
+
+	instances := []StackInstance{}
+	input := &cloudformation.ListStackInstancesInput{StackSetName: aws.String(ss.Name)}
+
+	err = ss.cf.ListStackInstancesPages(input, func(out *cloudformation.ListStackInstancesOutput, _ bool) bool {
+		for _, s := range out.Summaries {
+			instances = append(instances, StackInstance{
+				Account:            aws.StringValue(s.Account),
+				OrganizationalUnit: aws.StringValue(s.OrganizationalUnitId),
+				Region:             aws.StringValue(s.Region),
+				Status:             aws.StringValue(s.Status),
+				StatusReason:       aws.StringValue(s.StatusReason),
+			})
+		}
+
+		return true
+	})
+
+	return instances, err
+}
+
+// StackSetOperation is the operation started by sync of the stack set.
+type StackSetOperation struct {
+	ID     string
+	Action string
+	// Batch is the group of the instances the operation creates or deletes.
+	// It's empty for the update of the stack set, which updates all its
+	// instances.
+	Batch InstanceBatch
+}
+
+// StackSetOperationResult is the status of the operation on one instance of
+// the stack set.
+type StackSetOperationResult struct {
+	OperationID  string
+	Account      string
+	Region       string
+	Status       string
+	StatusReason string `json:",omitempty"`
+}
+
+// StackSetListener is notified about the progress of the stack set sync.
+type StackSetListener struct {
+	// OperationStarted is called when the operation is started.
+	OperationStarted func(op StackSetOperation)
+	// ResultChanged is called every time the status of the operation on the
+	// instance changes.
+	ResultChanged func(r StackSetOperationResult)
+}
+
+// Apply creates or updates the stack set and creates and deletes its
+// instances according to the plan. The operations are performed one by one
+// since cloudformation doesn't allow concurrent operations on the stack set.
+func (ss *StackSet) Apply(plan StackSetPlan, l StackSetListener) (err error) {
+	defer errd.Wrapf(&err, "failed to sync stack set %s", ss.Name)
+
+	switch {
+	case !plan.Exists:
+		if err = ss.create(); err != nil {
+			return err
+		}
+	case plan.Update:
+		if err = ss.update(l); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range plan.Create {
+		if err = ss.createInstances(b, l); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range plan.Delete {
+		if err = ss.deleteInstances(b, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ss *StackSet) create() error {
+	input := &cloudformation.CreateStackSetInput{
+		StackSetName:   aws.String(ss.Name),
+		Parameters:     ss.awsParameters(),
+		Tags:           ss.awsTags(),
+		Capabilities:   aws.StringSlice(ss.capabilities),
+		AutoDeployment: ss.settings.AutoDeployment,
+	}
+
+	if ss.settings.PermissionModel != "" {
+		input.PermissionModel = aws.String(ss.settings.PermissionModel)
+	}
+
+	if ss.settings.AdministrationRoleARN != "" {
+		input.AdministrationRoleARN = aws.String(ss.settings.AdministrationRoleARN)
+	}
+
+	if ss.settings.ExecutionRoleName != "" {
+		input.ExecutionRoleName = aws.String(ss.settings.ExecutionRoleName)
+	}
+
+	body, url, err := ss.templateLocation()
+	if err != nil {
+		return err
+	}
+
+	input.TemplateBody, input.TemplateURL = body, url
+
+	_, err = ss.cf.CreateStackSet(input)
+
+	return err
+}
+
+func (ss *StackSet) update(l StackSetListener) error {
+	input := &cloudformation.UpdateStackSetInput{
+		StackSetName:         aws.String(ss.Name),
+		Parameters:           ss.awsParameters(),
+		Tags:                 ss.awsTags(),
+		Capabilities:         aws.StringSlice(ss.capabilities),
+		AutoDeployment:       ss.settings.AutoDeployment,
+		OperationPreferences: ss.settings.OperationPreferences,
+	}
+
+	if ss.settings.PermissionModel != "" {
+		input.PermissionModel = aws.String(ss.settings.PermissionModel)
+	}
+
+	if ss.settings.AdministrationRoleARN != "" {
+		input.AdministrationRoleARN = aws.String(ss.settings.AdministrationRoleARN)
+	}
+
+	if ss.settings.ExecutionRoleName != "" {
+		input.ExecutionRoleName = aws.String(ss.settings.ExecutionRoleName)
+	}
+
+	body, url, err := ss.templateLocation()
+	if err != nil {
+		return err
+	}
+
+	input.TemplateBody, input.TemplateURL = body, url
+
+	out, err := ss.cf.UpdateStackSet(input)
+	if err != nil {
+		return err
+	}
+
+	return ss.track(StackSetOperation{
+		ID:     aws.StringValue(out.OperationId),
+		Action: cloudformation.StackSetOperationActionUpdate,
+	}, l)
+}
+
+func (ss *StackSet) createInstances(b InstanceBatch, l StackSetListener) error {
+	input := &cloudformation.CreateStackInstancesInput{
+		StackSetName:         aws.String(ss.Name),
+		Regions:              aws.StringSlice(b.Regions),
+		OperationPreferences: ss.settings.OperationPreferences,
+	}
+
+	if ss.settings.serviceManaged() {
+		input.DeploymentTargets = &cloudformation.DeploymentTargets{OrganizationalUnitIds: aws.StringSlice(b.Targets)}
+	} else {
+		input.Accounts = aws.StringSlice(b.Targets)
+	}
+
+	out, err := ss.cf.CreateStackInstances(input)
+	if err != nil {
+		return err
+	}
+
+	return ss.track(StackSetOperation{
+		ID:     aws.StringValue(out.OperationId),
+		Action: cloudformation.StackSetOperationActionCreate,
+		Batch:  b,
+	}, l)
+}
+
+func (ss *StackSet) deleteInstances(b InstanceBatch, l StackSetListener) error {
+	input := &cloudformation.DeleteStackInstancesInput{
+		StackSetName:         aws.String(ss.Name),
+		Regions:              aws.StringSlice(b.Regions),
+		RetainStacks:         aws.Bool(ss.settings.RetainStacks),
+		OperationPreferences: ss.settings.OperationPreferences,
+	}
+
+	if ss.settings.serviceManaged() {
+		input.DeploymentTargets = &cloudformation.DeploymentTargets{OrganizationalUnitIds: aws.StringSlice(b.Targets)}
+	} else {
+		input.Accounts = aws.StringSlice(b.Targets)
+	}
+
+	out, err := ss.cf.DeleteStackInstances(input)
+	if err != nil {
+		return err
+	}
+
+	return ss.track(StackSetOperation{
+		ID:     aws.StringValue(out.OperationId),
+		Action: cloudformation.StackSetOperationActionDelete,
+		Batch:  b,
+	}, l)
+}
+
+// templateLocation uploads the template to s3 if it's too big to be passed
+// in the request.
+func (ss *StackSet) templateLocation() (body, url *string, err error) {
+	if ss.url != "" {
+		return nil, aws.String(ss.url), nil
+	}
+
+	if ss.uploader != nil {
+		uploaded, err := ss.uploader.Upload(ss.Name, ss.body)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if uploaded != "" {
+			return nil, aws.String(uploaded), nil
+		}
+	}
+
+	return aws.String(ss.body), nil, nil
+}
+
+// track waits for the operation to finish and reports the status changes of
+// its instances. The operation is polled the same way the stack operations
+// are waited for.
+func (ss *StackSet) track(op StackSetOperation, l StackSetListener) error {
+	if l.OperationStarted != nil {
+		l.OperationStarted(op)
+	}
+
+	ctx, cancel := ss.wait.waiterContext()
+	defer cancel()
+
+	statuses := map[string]string{}
+
+	for attempt := 1; ; attempt++ {
+		out, err := ss.cf.DescribeStackSetOperationWithContext(ctx, &cloudformation.DescribeStackSetOperationInput{
+			StackSetName: aws.String(ss.Name),
+			OperationId:  aws.String(op.ID),
+		})
+		if err != nil {
+			return ss.wait.timeoutErr(ctx, err)
+		}
+
+		if err := ss.reportResults(op.ID, statuses, l); err != nil {
+			return err
+		}
+
+		status := aws.StringValue(out.StackSetOperation.Status)
+
+		switch status {
+		case cloudformation.StackSetOperationStatusSucceeded:
+			return nil
+		case cloudformation.StackSetOperationStatusFailed, cloudformation.StackSetOperationStatusStopped:
+			return ss.operationFailure(op, status, statuses)
+		}
+
+		if err := aws.SleepWithContext(ctx, ss.wait.delay(attempt)); err != nil {
+			return ss.wait.timeoutErr(ctx, awserr.New(request.CanceledErrorCode, "waiter context canceled", err))
+		}
+	}
+}
+
+func (ss *StackSet) reportResults(opID string, statuses map[string]string, l StackSetListener) error {
+	input := &cloudformation.ListStackSetOperationResultsInput{
+		StackSetName: aws.String(ss.Name),
+		OperationId:  aws.String(opID),
+	}
+
+	return ss.cf.ListStackSetOperationResultsPages(input, func(out *cloudformation.ListStackSetOperationResultsOutput, _ bool) bool {
+		for _, s := range out.Summaries {
+			r := StackSetOperationResult{
+				OperationID:  opID,
+				Account:      aws.StringValue(s.Account),
+				Region:       aws.StringValue(s.Region),
+				Status:       aws.StringValue(s.Status),
+				StatusReason: aws.StringValue(s.StatusReason),
+			}
+
+			key := r.Account + "/" + r.Region
+			if statuses[key] == r.Status {
+				continue
+			}
+
+			statuses[key] = r.Status
+
+			if l.ResultChanged != nil {
+				l.ResultChanged(r)
+			}
+		}
+
+		return true
+	})
+}
+
+func (ss *StackSet) operationFailure(op StackSetOperation, status string, statuses map[string]string) error {
+	failed := []string{}
+
+	for instance, s := range statuses {
+		if s == cloudformation.StackSetOperationResultStatusFailed {
+			failed = append(failed, instance)
+		}
+	}
+
+	sort.Strings(failed)
+
+	if len(failed) == 0 {
+		return fmt.Errorf("operation %s (%s) is %s", op.ID, op.Action, status)
+	}
+
+	return fmt.Errorf("operation %s (%s) is %s. Failed instances: %s",
+		op.ID, op.Action, status, strings.Join(failed, ", "))
+}
+
+func (ss *StackSet) awsParameters() []*cloudformation.Parameter {
+	params := make([]*cloudformation.Parameter, 0, len(ss.parameters))
+
+	for _, k := range sortedKeys(ss.parameters) {
+		params = append(params, &cloudformation.Parameter{
+			ParameterKey:   aws.String(k),
+			ParameterValue: aws.String(ss.parameters[k]),
+		})
+	}
+
+	return params
+}
+
+func (ss *StackSet) awsTags() []*cloudformation.Tag {
+	tags := make([]*cloudformation.Tag, 0, len(ss.tags))
+
+	for _, k := range sortedKeys(ss.tags) {
+		tags = append(tags, &cloudformation.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(ss.tags[k]),
+		})
+	}
+
+	return tags
+}
+
+// instanceKey identifies the instance of the stack set by its target (account
+// or organizational unit) and region.
+type instanceKey struct {
+	target string
+	region string
+}
+
+func instanceKeys(targets, regions []string) []instanceKey {
+	keys := make([]instanceKey, 0, len(targets)*len(regions))
+
+	for _, t := range targets {
+		for _, r := range regions {
+			keys = append(keys, instanceKey{t, r})
+		}
+	}
+
+	return keys
+}
+
+// diffInstances returns the instances that have to be created and the ones
+// that are deployed but not desired anymore.
+func diffInstances(desired, deployed []instanceKey) (create, remove []instanceKey) {
+	desiredSet := make(map[instanceKey]bool, len(desired))
+	for _, k := range desired {
+		desiredSet[k] = true
+	}
+
+	deployedSet := make(map[instanceKey]bool, len(deployed))
+	for _, k := range deployed {
+		deployedSet[k] = true
+	}
+
+	for _, k := range desired {
+		if !deployedSet[k] {
+			deployedSet[k] = true
+
+			create = append(create, k)
+		}
+	}
+
+	for _, k := range deployed {
+		if !desiredSet[k] {
+			desiredSet[k] = true
+
+			remove = append(remove, k)
+		}
+	}
+
+	return create, remove
+}
+
+// instanceBatches groups the instances into as few batches as possible. The
+// regions that have the same set of targets end up in the same batch, since
+// one operation deploys every target to every region of the batch.
+func instanceBatches(keys []instanceKey) []InstanceBatch {
+	targetsByRegion := map[string][]string{}
+	regions := []string{}
+
+	for _, k := range keys {
+		if _, ok := targetsByRegion[k.region]; !ok {
+			regions = append(regions, k.region)
+		}
+
+		targetsByRegion[k.region] = append(targetsByRegion[k.region], k.target)
+	}
+
+	sort.Strings(regions)
+
+	batchesByTargets := map[string]*InstanceBatch{}
+	order := []string{}
+
+	for _, region := range regions {
+		targets := sortedCopy(targetsByRegion[region])
+		id := strings.Join(targets, ",")
+
+		b, ok := batchesByTargets[id]
+		if !ok {
+			b = &InstanceBatch{Targets: targets}
+			batchesByTargets[id] = b
+			order = append(order, id)
+		}
+
+		b.Regions = append(b.Regions, region)
+	}
+
+	batches := make([]InstanceBatch, 0, len(order))
+	for _, id := range order {
+		batches = append(batches, *batchesByTargets[id])
+	}
+
+	return batches
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedCopy(ss []string) []string {
+	c := append([]string{}, ss...)
+	sort.Strings(c)
+
+	return c
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+
+	return m
+}
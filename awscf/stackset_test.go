@@ -0,0 +1,215 @@
+package awscf
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstancesAreBatchedByTargets(t *testing.T) {
+	create, remove := diffInstances(
+		instanceKeys([]string{"111", "222"}, []string{"eu-west-1", "us-east-1", "eu-central-1"}),
+		append(instanceKeys([]string{"111"}, []string{"eu-west-1", "us-east-1"}), instanceKey{"333", "eu-west-1"}),
+	)
+
+	assert.Equal(t, []InstanceBatch{
+		{Targets: []string{"111", "222"}, Regions: []string{"eu-central-1"}},
+		{Targets: []string{"222"}, Regions: []string{"eu-west-1", "us-east-1"}},
+	}, instanceBatches(create))
+
+	assert.Equal(t, []InstanceBatch{
+		{Targets: []string{"333"}, Regions: []string{"eu-west-1"}},
+	}, instanceBatches(remove))
+}
+
+func TestStackSetPlan(t *testing.T) {
+	cf := &stackSetCFMock{
+		stackSet: &cloudformation.StackSet{
+			TemplateBody: aws.String("Resources: {}"),
+			Parameters: []*cloudformation.Parameter{
+				{ParameterKey: aws.String("Env"), ParameterValue: aws.String("dev")},
+			},
+		},
+		instances: []*cloudformation.StackInstanceSummary{
+			{Account: aws.String("111"), Region: aws.String("eu-west-1")},
+			{Account: aws.String("222"), Region: aws.String("eu-west-1")},
+		},
+	}
+
+	settings := StackSetSettings{
+		DeploymentTargets: DeploymentTargets{
+			Accounts: []string{"111", "333"},
+			Regions:  []string{"eu-west-1"},
+		},
+	}
+
+	ss := NewStackSet("myset", cf, nil).
+		WithTemplate("Resources: {}", "").
+		WithParameters(map[string]string{"Env": "prod"}).
+		WithSettings(settings)
+
+	plan, err := ss.Plan()
+	require.NoError(t, err)
+
+	assert.True(t, plan.Exists)
+	assert.True(t, plan.Update)
+	assert.Equal(t, []InstanceBatch{{Targets: []string{"333"}, Regions: []string{"eu-west-1"}}}, plan.Create)
+	assert.Empty(t, plan.Delete, "dropped instances are kept unless their removal is enabled")
+
+	sections, err := ChSetDiff{}.StackSetSections(plan)
+	require.NoError(t, err)
+	require.Len(t, sections, 1)
+	assert.Equal(t, "Parameters", sections[0].Name)
+	assert.Contains(t, sections[0].Diff, "-Env: dev")
+	assert.Contains(t, sections[0].Diff, "+Env: prod")
+
+	settings.RemoveDroppedInstances = true
+
+	plan, err = ss.WithSettings(settings).Plan()
+	require.NoError(t, err)
+	assert.Equal(t, []InstanceBatch{{Targets: []string{"222"}, Regions: []string{"eu-west-1"}}}, plan.Delete)
+}
+
+func TestStackSetPlanIgnoresTemplateFormatting(t *testing.T) {
+	cf := &stackSetCFMock{
+		stackSet: &cloudformation.StackSet{
+			TemplateBody: aws.String(`{"Resources": {"Queue": {"Type": "AWS::SQS::Queue"}}}`),
+		},
+		instances: []*cloudformation.StackInstanceSummary{
+			{Account: aws.String("111"), Region: aws.String("eu-west-1")},
+		},
+	}
+
+	plan, err := NewStackSet("myset", cf, nil).
+		WithTemplate("Resources:\n  Queue:\n    Type: AWS::SQS::Queue\n", "").
+		WithSettings(StackSetSettings{
+			DeploymentTargets: DeploymentTargets{Accounts: []string{"111"}, Regions: []string{"eu-west-1"}},
+		}).
+		Plan()
+	require.NoError(t, err)
+
+	assert.False(t, plan.Update)
+	assert.False(t, plan.HasChanges())
+}
+
+func TestStackSetOperationIsPolledUntilItCompletes(t *testing.T) {
+	cf := &stackSetCFMock{
+		stackSet:   &cloudformation.StackSet{TemplateBody: aws.String("Resources: {}")},
+		opStatuses: []string{cloudformation.StackSetOperationStatusRunning, cloudformation.StackSetOperationStatusSucceeded},
+	}
+
+	results := []string{}
+
+	err := NewStackSet("myset", cf, nil).
+		WithTemplate("Resources: {Queue: {Type: AWS::SQS::Queue}}", "").
+		WithWaitSettings(WaitSettings{PollIntervalSeconds: 1}).
+		Apply(StackSetPlan{Exists: true, Update: true}, StackSetListener{
+			ResultChanged: func(r StackSetOperationResult) {
+				results = append(results, r.Status)
+			},
+		})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, cf.polls)
+	assert.Equal(t, []string{"RUNNING", "SUCCEEDED"}, results)
+}
+
+func TestStackSetPlanWhenStackSetDoesntExist(t *testing.T) {
+	ss := NewStackSet("myset", &stackSetCFMock{}, nil).
+		WithTemplate("Resources: {}", "").
+		WithSettings(StackSetSettings{
+			PermissionModel: cloudformation.PermissionModelsServiceManaged,
+			DeploymentTargets: DeploymentTargets{
+				OrganizationalUnits: []string{"ou-1"},
+				Regions:             []string{"eu-west-1", "us-east-1"},
+			},
+		})
+
+	plan, err := ss.Plan()
+	require.NoError(t, err)
+
+	assert.False(t, plan.Exists)
+	assert.True(t, plan.HasChanges())
+	assert.Equal(t, []InstanceBatch{{Targets: []string{"ou-1"}, Regions: []string{"eu-west-1", "us-east-1"}}}, plan.Create)
+}
+
+func TestStackSetPlanRequiresTargets(t *testing.T) {
+	_, err := NewStackSet("myset", &stackSetCFMock{}, nil).
+		WithTemplate("Resources: {}", "").
+		WithSettings(StackSetSettings{
+			PermissionModel:   cloudformation.PermissionModelsServiceManaged,
+			DeploymentTargets: DeploymentTargets{Accounts: []string{"111"}},
+		}).
+		Plan()
+
+	assert.EqualError(t, err,
+		"failed to plan changes of stack set myset: deployment targets must list organizational units of the SERVICE_MANAGED stack set")
+}
+
+type stackSetCFMock struct {
+	cloudformationiface.CloudFormationAPI
+
+	stackSet  *cloudformation.StackSet
+	instances []*cloudformation.StackInstanceSummary
+
+	// opStatuses are the statuses the operation reports on every poll
+	opStatuses []string
+	polls      int
+}
+
+func (cf *stackSetCFMock) DescribeStackSet(*cloudformation.DescribeStackSetInput) (*cloudformation.DescribeStackSetOutput, error) {
+	if cf.stackSet == nil {
+		return nil, awserr.New(cloudformation.ErrCodeStackSetNotFoundException, "StackSet myset not found", nil)
+	}
+
+	return &cloudformation.DescribeStackSetOutput{StackSet: cf.stackSet}, nil
+}
+
+func (cf *stackSetCFMock) ListStackInstancesPages(
+	_ *cloudformation.ListStackInstancesInput,
+	fn func(*cloudformation.ListStackInstancesOutput, bool) bool,
+) error {
+	fn(&cloudformation.ListStackInstancesOutput{Summaries: cf.instances}, true)
+	return nil
+}
+
+func (cf *stackSetCFMock) UpdateStackSet(*cloudformation.UpdateStackSetInput) (*cloudformation.UpdateStackSetOutput, error) {
+	return &cloudformation.UpdateStackSetOutput{OperationId: aws.String("op-1")}, nil
+}
+
+func (cf *stackSetCFMock) DescribeStackSetOperationWithContext(
+	_ aws.Context,
+	_ *cloudformation.DescribeStackSetOperationInput,
+	_ ...request.Option,
+) (*cloudformation.DescribeStackSetOperationOutput, error) {
+	cf.polls++
+
+	return &cloudformation.DescribeStackSetOperationOutput{
+		StackSetOperation: &cloudformation.StackSetOperation{Status: aws.String(cf.opStatus())},
+	}, nil
+}
+
+func (cf *stackSetCFMock) ListStackSetOperationResultsPages(
+	_ *cloudformation.ListStackSetOperationResultsInput,
+	fn func(*cloudformation.ListStackSetOperationResultsOutput, bool) bool,
+) error {
+	fn(&cloudformation.ListStackSetOperationResultsOutput{
+		Summaries: []*cloudformation.StackSetOperationResultSummary{{
+			Account: aws.String("111"),
+			Region:  aws.String("eu-west-1"),
+			Status:  aws.String(cf.opStatus()),
+		}},
+	}, true)
+
+	return nil
+}
+
+func (cf *stackSetCFMock) opStatus() string {
+	return cf.opStatuses[cf.polls-1]
+}
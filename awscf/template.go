@@ -0,0 +1,347 @@
+package awscf
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/molecule-man/stack-assembly/errd"
+	"gopkg.in/yaml.v3"
+)
+
+const importValueFn = "Fn::ImportValue"
+
+// TemplateImports returns the export names that are imported by the template
+// via Fn::ImportValue. Only literal export names are returned, imports that
+// are computed with other intrinsic functions (e.g. !Sub) are ignored.
+func TemplateImports(body string) ([]string, error) {
+	var root yaml.Node
+
+	if err := yaml.Unmarshal([]byte(body), &root); err != nil {
+		return []string{}, err
+	}
+
+	found := map[string]bool{}
+	collectImports(&root, found)
+
+	imports := make([]string, 0, len(found))
+	for name := range found {
+		imports = append(imports, name)
+	}
+
+	sort.Strings(imports)
+
+	return imports, nil
+}
+
+func collectImports(node *yaml.Node, found map[string]bool) {
+	if node.Tag == "!ImportValue" && node.Kind == yaml.ScalarNode {
+		found[node.Value] = true
+		return
+	}
+
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+
+			if key.Value == importValueFn && val.Kind == yaml.ScalarNode && val.Tag == "!!str" {
+				found[val.Value] = true
+				continue
+			}
+
+			collectImports(val, found)
+		}
+
+		return
+	}
+
+	for _, child := range node.Content {
+		collectImports(child, found)
+	}
+}
+
+// TemplateChange is a change of a single node of the template. Action is one
+// of ActionAdd, ActionModify or ActionRemove. Path is the
+// dot separated path of the node, e.g.
+// `Resources.Queue.Properties.VisibilityTimeout`.
+type TemplateChange struct {
+	Action string
+	Path   string
+	Old    interface{} `json:",omitempty"`
+	New    interface{} `json:",omitempty"`
+}
+
+func (c TemplateChange) String() string {
+	switch c.Action {
+	case ActionAdd:
+		return fmt.Sprintf("+ %s: %s", c.Path, templateValue(c.New))
+	case ActionRemove:
+		return fmt.Sprintf("- %s: %s", c.Path, templateValue(c.Old))
+	}
+
+	return fmt.Sprintf("~ %s: %s → %s", c.Path, templateValue(c.Old), templateValue(c.New))
+}
+
+// ParseTemplate parses json or yaml template body. Short form intrinsic
+// functions (e.g. `!Ref Queue`) are converted into their full form (e.g.
+// `{"Ref": "Queue"}`) so that the templates written in different styles can
+// be compared.
+func ParseTemplate(body string) (interface{}, error) {
+	var root yaml.Node
+
+	if err := yaml.Unmarshal([]byte(body), &root); err != nil {
+		return nil, err
+	}
+
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	return templateNodeValue(root.Content[0])
+}
+
+// TemplateResourceTypes returns the types of the resources declared in the
+// template. Every type is returned once.
+func TemplateResourceTypes(body string) ([]string, error) {
+	tpl, err := ParseTemplate(body)
+	if err != nil {
+		return []string{}, err
+	}
+
+	root, _ := tpl.(map[string]interface{})
+	resources, _ := root["Resources"].(map[string]interface{})
+
+	found := map[string]bool{}
+
+	for _, res := range resources {
+		props, _ := res.(map[string]interface{})
+		if typ, ok := props["Type"].(string); ok {
+			found[typ] = true
+		}
+	}
+
+	types := make([]string, 0, len(found))
+	for typ := range found {
+		types = append(types, typ)
+	}
+
+	sort.Strings(types)
+
+	return types, nil
+}
+
+// DiffTemplates compares templates structurally. Templates that differ only
+// in formatting, order of keys or the form of intrinsic functions are
+// considered to be equal.
+func DiffTemplates(oldBody, newBody string) (_ []TemplateChange, err error) {
+	defer errd.Wrapf(&err, "failed to compare templates")
+
+	var oldTpl interface{}
+
+	if strings.TrimSpace(oldBody) != "" {
+		oldTpl, err = ParseTemplate(oldBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newTpl, err := ParseTemplate(newBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldTpl == nil {
+		oldTpl = map[string]interface{}{}
+	}
+
+	changes := []TemplateChange{}
+	diffTemplateValues("", oldTpl, newTpl, &changes)
+
+	return changes, nil
+}
+
+func diffTemplateValues(path string, oldVal, newVal interface{}, changes *[]TemplateChange) {
+	if reflect.DeepEqual(oldVal, newVal) {
+		return
+	}
+
+	oldMap, oldIsMap := oldVal.(map[string]interface{})
+	newMap, newIsMap := newVal.(map[string]interface{})
+
+	// calls of intrinsic functions are compared as a whole
+	if oldIsMap && newIsMap && !isIntrinsicCall(oldMap) && !isIntrinsicCall(newMap) {
+		diffTemplateMaps(path, oldMap, newMap, changes)
+		return
+	}
+
+	oldList, oldIsList := oldVal.([]interface{})
+	newList, newIsList := newVal.([]interface{})
+
+	if oldIsList && newIsList && len(oldList) == len(newList) {
+		for i := range oldList {
+			diffTemplateValues(fmt.Sprintf("%s[%d]", path, i), oldList[i], newList[i], changes)
+		}
+
+		return
+	}
+
+	*changes = append(*changes, TemplateChange{Action: ActionModify, Path: path, Old: oldVal, New: newVal})
+}
+
+func diffTemplateMaps(path string, oldMap, newMap map[string]interface{}, changes *[]TemplateChange) {
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+
+	for k := range oldMap {
+		keys = append(keys, k)
+	}
+
+	for k := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		keyPath := k
+		if path != "" {
+			keyPath = path + "." + k
+		}
+
+		oldVal, inOld := oldMap[k]
+		newVal, inNew := newMap[k]
+
+		// top level sections (e.g. Resources) are compared key by key even
+		// if they are absent in one of the templates
+		if _, ok := newVal.(map[string]interface{}); ok && path == "" && !inOld {
+			oldVal, inOld = map[string]interface{}{}, true
+		}
+
+		if _, ok := oldVal.(map[string]interface{}); ok && path == "" && !inNew {
+			newVal, inNew = map[string]interface{}{}, true
+		}
+
+		switch {
+		case !inOld:
+			*changes = append(*changes, TemplateChange{Action: ActionAdd, Path: keyPath, New: newVal})
+		case !inNew:
+			*changes = append(*changes, TemplateChange{Action: ActionRemove, Path: keyPath, Old: oldVal})
+		default:
+			diffTemplateValues(keyPath, oldVal, newVal, changes)
+		}
+	}
+}
+
+func templateNodeValue(node *yaml.Node) (interface{}, error) {
+	if node.Kind == yaml.AliasNode {
+		return templateNodeValue(node.Alias)
+	}
+
+	if fn, ok := intrinsicFunction(node.Tag); ok {
+		return intrinsicValue(fn, node)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			val, err := templateNodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			m[node.Content[i].Value] = val
+		}
+
+		return m, nil
+	case yaml.SequenceNode:
+		l := make([]interface{}, 0, len(node.Content))
+
+		for _, n := range node.Content {
+			val, err := templateNodeValue(n)
+			if err != nil {
+				return nil, err
+			}
+
+			l = append(l, val)
+		}
+
+		return l, nil
+	}
+
+	var val interface{}
+	err := node.Decode(&val)
+
+	return val, err
+}
+
+func isIntrinsicCall(m map[string]interface{}) bool {
+	if len(m) != 1 {
+		return false
+	}
+
+	for k := range m {
+		return k == "Ref" || k == "Condition" || strings.HasPrefix(k, "Fn::")
+	}
+
+	return false
+}
+
+// intrinsicFunction returns the full name of the intrinsic function the short
+// form tag stands for.
+func intrinsicFunction(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "!!") {
+		return "", false
+	}
+
+	switch name := strings.TrimPrefix(tag, "!"); name {
+	case "Ref", "Condition":
+		return name, true
+	default:
+		return "Fn::" + name, true
+	}
+}
+
+func intrinsicValue(fn string, node *yaml.Node) (interface{}, error) {
+	if node.Kind != yaml.ScalarNode {
+		plain := *node
+		plain.Tag = ""
+
+		val, err := templateNodeValue(&plain)
+
+		return map[string]interface{}{fn: val}, err
+	}
+
+	if fn == "Fn::GetAtt" {
+		parts := strings.SplitN(node.Value, ".", 2)
+		args := make([]interface{}, 0, len(parts))
+
+		for _, p := range parts {
+			args = append(args, p)
+		}
+
+		return map[string]interface{}{fn: args}, nil
+	}
+
+	return map[string]interface{}{fn: node.Value}, nil
+}
+
+func templateValue(val interface{}) string {
+	switch v := val.(type) {
+	case map[string]interface{}, []interface{}:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+
+		return string(buf)
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,128 @@
+package awscf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateImports(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected []string
+	}{{
+		body: `
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !ImportValue queue-name
+      RedrivePolicy:
+        deadLetterTargetArn:
+          Fn::ImportValue: dlq-arn
+      Tags:
+        - Key: computed
+          Value: !ImportValue
+            Fn::Sub: "${AWS::StackName}-computed"`,
+		expected: []string{"dlq-arn", "queue-name"},
+	}, {
+		body: `{
+  "Resources": {
+    "Topic": {
+      "Type": "AWS::SNS::Topic",
+      "Properties": {
+        "TopicName": {"Fn::ImportValue": "topic-name"},
+        "DisplayName": {"Fn::ImportValue": "topic-name"}
+      }
+    }
+  }
+}`,
+		expected: []string{"topic-name"},
+	}, {
+		body:     `Resources: {}`,
+		expected: []string{},
+	}}
+
+	for _, tc := range cases {
+		imports, err := TemplateImports(tc.body)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, imports)
+	}
+}
+
+func TestTemplateResourceTypes(t *testing.T) {
+	body := `
+Description: Mentions AWS::CloudFormation::Stack but doesn't have one
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+  Dlq:
+    Type: AWS::SQS::Queue
+  App:
+    Type: AWS::Serverless::Application`
+
+	types, err := TemplateResourceTypes(body)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AWS::SQS::Queue", "AWS::Serverless::Application"}, types)
+}
+
+func TestDiffTemplates(t *testing.T) {
+	oldBody := `
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !Ref QueueName
+      VisibilityTimeout: 10
+  Topic:
+    Type: AWS::SNS::Topic
+Outputs:
+  QueueArn:
+    Value: !GetAtt Queue.Arn`
+	newBody := `{
+  "Outputs": {"QueueArn": {"Value": {"Fn::GetAtt": ["Queue", "Arn"]}}},
+  "Resources": {
+    "Queue": {
+      "Type": "AWS::SQS::Queue",
+      "Properties": {
+        "QueueName": {"Fn::Sub": "QueueName"},
+        "VisibilityTimeout": 20
+      }
+    },
+    "Bucket": {"Type": "AWS::S3::Bucket"}
+  }
+}`
+
+	changes, err := DiffTemplates(oldBody, newBody)
+	require.NoError(t, err)
+
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+
+	assert.Equal(t, []string{
+		`+ Resources.Bucket: {"Type":"AWS::S3::Bucket"}`,
+		`~ Resources.Queue.Properties.QueueName: {"Ref":"QueueName"} → {"Fn::Sub":"QueueName"}`,
+		`~ Resources.Queue.Properties.VisibilityTimeout: 10 → 20`,
+		`- Resources.Topic: {"Type":"AWS::SNS::Topic"}`,
+	}, lines)
+}
+
+func TestDiffTemplatesIgnoresFormatting(t *testing.T) {
+	oldBody := `
+Resources:
+  Topic:
+    Properties:
+      DisplayName: !Sub "${AWS::StackName}-topic"
+    Type: AWS::SNS::Topic`
+	newBody := `{"Resources": {"Topic": {
+  "Type": "AWS::SNS::Topic",
+  "Properties": {"DisplayName": {"Fn::Sub": "${AWS::StackName}-topic"}}
+}}}`
+
+	changes, err := DiffTemplates(oldBody, newBody)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
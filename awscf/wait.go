@@ -0,0 +1,143 @@
+package awscf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Defaults of WaitSettings.
+const (
+	DefaultTimeoutInMinutes       = 30
+	DefaultPollIntervalSeconds    = 2
+	DefaultMaxPollIntervalSeconds = 10
+
+	// change sets are usually created in seconds, so they are polled more
+	// often
+	changeSetPollInterval  = time.Second
+	changeSetTimeoutInMins = 60
+)
+
+// WaitSettings controls how long stack-assembly waits for stack operations to
+// complete and how often the status of the stack is polled. The interval
+// between polls grows by half on every attempt until it reaches the max poll
+// interval. A random jitter is added to the interval, so that the stacks
+// deployed in parallel don't hit API rate limits at the same moment.
+type WaitSettings struct {
+	TimeoutInMinutes       int
+	PollIntervalSeconds    int
+	MaxPollIntervalSeconds int
+}
+
+// Merge fills the settings that are not set with the values of otherCfg.
+func (ws *WaitSettings) Merge(otherCfg WaitSettings) {
+	if ws.TimeoutInMinutes == 0 {
+		ws.TimeoutInMinutes = otherCfg.TimeoutInMinutes
+	}
+
+	if ws.PollIntervalSeconds == 0 {
+		ws.PollIntervalSeconds = otherCfg.PollIntervalSeconds
+	}
+
+	if ws.MaxPollIntervalSeconds == 0 {
+		ws.MaxPollIntervalSeconds = otherCfg.MaxPollIntervalSeconds
+	}
+}
+
+func (ws WaitSettings) timeout() time.Duration {
+	if ws.TimeoutInMinutes > 0 {
+		return time.Duration(ws.TimeoutInMinutes) * time.Minute
+	}
+
+	return DefaultTimeoutInMinutes * time.Minute
+}
+
+func (ws WaitSettings) pollInterval() time.Duration {
+	if ws.PollIntervalSeconds > 0 {
+		return time.Duration(ws.PollIntervalSeconds) * time.Second
+	}
+
+	return DefaultPollIntervalSeconds * time.Second
+}
+
+func (ws WaitSettings) maxPollInterval() time.Duration {
+	maxInterval := DefaultMaxPollIntervalSeconds * time.Second
+	if ws.MaxPollIntervalSeconds > 0 {
+		maxInterval = time.Duration(ws.MaxPollIntervalSeconds) * time.Second
+	}
+
+	if maxInterval < ws.pollInterval() {
+		return ws.pollInterval()
+	}
+
+	return maxInterval
+}
+
+// delay returns the interval to wait before the next poll.
+func (ws WaitSettings) delay(attempt int) time.Duration {
+	d := float64(ws.pollInterval())
+	maxInterval := float64(ws.maxPollInterval())
+
+	for i := 1; i < attempt && d < maxInterval; i++ {
+		d *= 1.5
+	}
+
+	if d > maxInterval {
+		d = maxInterval
+	}
+
+	// up to 10% of jitter
+	d += d * 0.1 * rand.Float64() //nolint:gosec
+
+	return time.Duration(d)
+}
+
+// waiterContext returns the context that expires when the stack operation
+// times out.
+func (ws WaitSettings) waiterContext() (aws.Context, context.CancelFunc) {
+	return context.WithTimeout(aws.BackgroundContext(), ws.timeout())
+}
+
+// waiterOptions makes the waiter poll until the context expires.
+func (ws WaitSettings) waiterOptions() request.WaiterOption {
+	return func(w *request.Waiter) {
+		w.MaxAttempts = 0
+		w.Delay = ws.delay
+	}
+}
+
+// timeoutErr turns the error of the waiter that was canceled because of the
+// timeout into a human readable error.
+func (ws WaitSettings) timeoutErr(ctx aws.Context, err error) error {
+	var aerr awserr.Error
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && errors.As(err, &aerr) &&
+		(aerr.Code() == request.CanceledErrorCode || aerr.Code() == request.WaiterResourceNotReadyErrorCode) {
+		return fmt.Errorf("operation has not completed in %d minute(s): %w", int(ws.timeout().Minutes()), err)
+	}
+
+	return err
+}
+
+// changeSetWaitSettings returns the settings used to wait for change set
+// creation. Only the timeout can be extended by the stack settings.
+func (ws WaitSettings) changeSetWaitSettings() WaitSettings {
+	timeout := ws.TimeoutInMinutes
+	if timeout < changeSetTimeoutInMins {
+		timeout = changeSetTimeoutInMins
+	}
+
+	seconds := int(changeSetPollInterval / time.Second)
+
+	return WaitSettings{
+		TimeoutInMinutes:       timeout,
+		PollIntervalSeconds:    seconds,
+		MaxPollIntervalSeconds: seconds,
+	}
+}
@@ -0,0 +1,30 @@
+package awscf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitDelayBacksOff(t *testing.T) {
+	ws := WaitSettings{PollIntervalSeconds: 2, MaxPollIntervalSeconds: 5}
+
+	assert.InDelta(t, 2*time.Second, ws.delay(1), float64(200*time.Millisecond))
+	assert.InDelta(t, 3*time.Second, ws.delay(2), float64(300*time.Millisecond))
+	assert.InDelta(t, 5*time.Second, ws.delay(10), float64(500*time.Millisecond))
+}
+
+func TestWaitTimeoutError(t *testing.T) {
+	ws := WaitSettings{TimeoutInMinutes: 45}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	<-ctx.Done()
+
+	err := ws.timeoutErr(ctx, awserr.New(request.CanceledErrorCode, "waiter context canceled", nil))
+	assert.Contains(t, err.Error(), "operation has not completed in 45 minute(s)")
+}
@@ -2,10 +2,12 @@ package cli
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 )
 
 func Fprint(w io.Writer, msg string) {
@@ -18,6 +20,11 @@ type CLI struct {
 	Errorer io.Writer
 
 	Color Color
+
+	// Level is the verbosity of the messages printed to the console.
+	Level Level
+	// JSONLog records the messages if it's not nil.
+	JSONLog *JSONLog
 }
 
 func (cli CLI) Print(msg string) {
@@ -29,7 +36,7 @@ func (cli CLI) Printf(msg string, args ...interface{}) {
 }
 
 func (cli CLI) Error(msg string) {
-	Fprint(cli.Errorer, cli.Color.Fail(msg))
+	cli.Log(LevelError, msg, nil)
 }
 
 func (cli CLI) Errorf(format string, args ...interface{}) {
@@ -37,19 +44,19 @@ func (cli CLI) Errorf(format string, args ...interface{}) {
 }
 
 func (cli CLI) Info(msg string) {
-	cli.Print(msg)
+	cli.Log(LevelInfo, msg, nil)
 }
 
 func (cli CLI) Infof(format string, args ...interface{}) {
-	cli.Print(fmt.Sprintf(format, args...))
+	cli.Info(fmt.Sprintf(format, args...))
 }
 
 func (cli CLI) Warn(msg string) {
-	cli.Print(cli.Color.Warn(msg))
+	cli.Log(LevelWarn, msg, nil)
 }
 
 func (cli CLI) Warnf(format string, args ...interface{}) {
-	cli.Printf(cli.Color.Warn(format), args...)
+	cli.Warn(fmt.Sprintf(format, args...))
 }
 
 func (cli CLI) Prompt(commands []PromptCmd) error {
@@ -143,6 +150,58 @@ func (l *Logger) Warnf(format string, args ...interface{}) {
 	l.cli.Warnf(l.prefixedMsg(format), args...)
 }
 
+func (l *Logger) Debug(msg string, fields Fields) {
+	l.cli.Debug(l.prefixedMsg(msg), fields)
+}
+
+func (l *Logger) Trace(msg string, fields Fields) {
+	l.cli.Trace(l.prefixedMsg(msg), fields)
+}
+
+// Writer returns the writer that logs every line written to it as the info
+// message of the logger. Close logs the last line if it doesn't end with a
+// newline. The writer is safe for concurrent use.
+func (l *Logger) Writer() io.WriteCloser {
+	return &lineWriter{log: l.Info}
+}
+
+type lineWriter struct {
+	mu  sync.Mutex
+	log func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.log(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+
+	return nil
+}
+
 var ErrPromptCommandIsNotKnown = errors.New("prompt command is not known")
 
 type PromptCmd struct {
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// LiveView is a block of lines that is redrawn in place on every render. It
+// relies on ANSI escape sequences and therefore is meant for terminals only.
+type LiveView struct {
+	w        io.Writer
+	width    func() int
+	rendered int
+}
+
+// NewLiveView creates a live view writing into w.
+func NewLiveView(w io.Writer) *LiveView {
+	return &LiveView{w: w, width: func() int { return terminalWidth(w) }}
+}
+
+// Render replaces the previously rendered lines with the new ones. The lines
+// are truncated to the width of the terminal, since the wrapped ones would
+// take more rows than counted and wouldn't be cleared on the next render.
+func (v *LiveView) Render(lines ...string) error {
+	width := v.width()
+	b := &strings.Builder{}
+
+	if v.rendered > 0 {
+		// move the cursor to the beginning of the block
+		fmt.Fprintf(b, "\x1b[%dA", v.rendered)
+	}
+
+	// clear everything below the cursor
+	b.WriteString("\x1b[J")
+
+	v.rendered = 0
+
+	for _, l := range lines {
+		for _, physical := range strings.Split(l, "\n") {
+			b.WriteString(truncate(physical, width))
+			b.WriteString("\n")
+			v.rendered++
+		}
+	}
+
+	_, err := io.WriteString(v.w, b.String())
+
+	return err
+}
+
+// truncate cuts the line to width characters. The color codes don't count
+// towards the width. The line is left as is if width is not positive.
+func truncate(line string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(RmColors(line)) <= width {
+		return line
+	}
+
+	b := &strings.Builder{}
+	visible := 0
+
+	for i := 0; i < len(line) && visible < width; {
+		if strings.HasPrefix(line[i:], start) {
+			if n := strings.Index(line[i:], end); n >= 0 {
+				b.WriteString(line[i : i+n+1])
+				i += n + 1
+
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(line[i:])
+		b.WriteRune(r)
+		i += size
+		visible++
+	}
+
+	if HasColors(line) {
+		b.WriteString(ResetCode)
+	}
+
+	return b.String()
+}
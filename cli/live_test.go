@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveViewRedrawsRenderedLines(t *testing.T) {
+	buf := &bytes.Buffer{}
+	v := NewLiveView(buf)
+
+	require.NoError(t, v.Render("a", "b\nc"))
+	assert.Equal(t, "\x1b[Ja\nb\nc\n", buf.String())
+
+	buf.Reset()
+
+	require.NoError(t, v.Render("d"))
+	assert.Equal(t, "\x1b[3A\x1b[Jd\n", buf.String())
+}
+
+func TestLiveViewTruncatesLinesToTerminalWidth(t *testing.T) {
+	buf := &bytes.Buffer{}
+	v := NewLiveView(buf)
+	v.width = func() int { return 4 }
+
+	require.NoError(t, v.Render("abcdef", "ab", "\x1b[31mabcdef\x1b[0m", "ü\x1b[31mber\x1b[0m"))
+	assert.Equal(t, "\x1b[Jabcd\nab\n\x1b[31mabcd\x1b[0m\nü\x1b[31mber\x1b[0m\n", buf.String())
+
+	buf.Reset()
+
+	require.NoError(t, v.Render("d"))
+	assert.Equal(t, "\x1b[4A\x1b[Jd\n", buf.String())
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import "io"
+
+// terminalWidth returns zero as the width of the console isn't looked up on
+// windows, so the lines of the live view are not truncated.
+func terminalWidth(w io.Writer) int {
+	return 0
+}
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the verbosity of the messages. The zero value is LevelInfo, so
+// that the CLI that is not configured prints everything it used to.
+type Level int
+
+const (
+	LevelError Level = iota - 2
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	case LevelTrace:
+		return "trace"
+	}
+
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Fields are the key-value pairs attached to the log message.
+type Fields map[string]interface{}
+
+// String renders fields as space separated key=value pairs sorted by key.
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, fieldValue(f[k])))
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+func fieldValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		if buf, err := json.Marshal(v); err == nil {
+			return string(buf)
+		}
+	}
+
+	return fmt.Sprint(v)
+}
+
+// JSONLog writes log messages as JSON lines. It records debug messages even if
+// they are not printed to the console, so that the log file can be used to
+// investigate the problem after the fact.
+type JSONLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+func NewJSONLog(w io.Writer) *JSONLog {
+	return &JSONLog{w: w, now: time.Now}
+}
+
+func (l *JSONLog) write(level Level, msg string, fields Fields) error {
+	record := make(map[string]interface{}, len(fields)+3)
+
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+
+		record[k] = v
+	}
+
+	record["time"] = l.now().Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["msg"] = msg
+
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = fmt.Fprintln(l.w, string(buf))
+
+	return err
+}
+
+// Close closes the writer of the log if it's closable.
+func (l *JSONLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// Enabled returns true if the messages of the level are printed to the
+// console or recorded in the log file.
+func (cli CLI) Enabled(level Level) bool {
+	return level <= cli.Level || (cli.JSONLog != nil && level <= cli.jsonLogLevel())
+}
+
+func (cli CLI) jsonLogLevel() Level {
+	if cli.Level > LevelDebug {
+		return cli.Level
+	}
+
+	return LevelDebug
+}
+
+// Log prints the message to the console if the level is enabled and records
+// it in the log file. Error and warning messages are colorized on the console.
+// Debug and trace messages are printed to the error writer, so they don't mix
+// with the output of the command.
+func (cli CLI) Log(level Level, msg string, fields Fields) {
+	if cli.JSONLog != nil && level <= cli.jsonLogLevel() {
+		if err := cli.JSONLog.write(level, msg, fields); err != nil {
+			Fprint(cli.Errorer, cli.Color.Fail(fmt.Sprintf("failed to write log: %s", err)))
+		}
+	}
+
+	if level > cli.Level {
+		return
+	}
+
+	if len(fields) > 0 {
+		msg = msg + " " + fields.String()
+	}
+
+	switch level {
+	case LevelError:
+		Fprint(cli.Errorer, cli.Color.Fail(msg))
+	case LevelWarn:
+		cli.Print(cli.Color.Warn(msg))
+	case LevelInfo:
+		cli.Print(msg)
+	default:
+		Fprint(cli.Errorer, msg)
+	}
+}
+
+func (cli CLI) Debug(msg string, fields Fields) {
+	cli.Log(LevelDebug, msg, fields)
+}
+
+func (cli CLI) Trace(msg string, fields Fields) {
+	cli.Log(LevelTrace, msg, fields)
+}
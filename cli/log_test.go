@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRespectsLevel(t *testing.T) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	c := CLI{Writer: out, Errorer: errOut, Color: Color{Disabled: true}, Level: LevelWarn}
+
+	c.Info("info")
+	c.Warn("warn")
+	c.Debug("debug", nil)
+	c.Error("error")
+
+	assert.Equal(t, "warn\n", out.String())
+	assert.Equal(t, "error\n", errOut.String())
+
+	errOut.Reset()
+	c.Level = LevelDebug
+	c.Debug("request", Fields{"op": "CreateStack", "retries": 1})
+
+	assert.Equal(t, "request op=CreateStack retries=1\n", errOut.String())
+}
+
+func TestJSONLogRecordsDebugMessages(t *testing.T) {
+	logOut := &bytes.Buffer{}
+	log := NewJSONLog(logOut)
+	log.now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	c := CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}, JSONLog: log}
+
+	assert.True(t, c.Enabled(LevelDebug))
+	assert.False(t, c.Enabled(LevelTrace))
+
+	c.Warn("careful")
+	c.Debug("request", Fields{"op": "CreateStack"})
+	c.Trace("params", nil)
+
+	assert.Equal(t,
+		`{"level":"warn","msg":"careful","time":"2020-01-02T03:04:05Z"}`+"\n"+
+			`{"level":"debug","msg":"request","op":"CreateStack","time":"2020-01-02T03:04:05Z"}`+"\n",
+		logOut.String())
+}
+
+func TestLoggerWriterLogsLines(t *testing.T) {
+	out := &bytes.Buffer{}
+	c := CLI{Writer: out, Errorer: &bytes.Buffer{}}
+
+	w := c.PrefixedLogger("[app] ").Writer()
+
+	_, err := w.Write([]byte("first\nsec"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[app] first\n", out.String())
+
+	_, err = w.Write([]byte("ond\r\nlast"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "[app] first\n[app] second\n[app] last\n", out.String())
+}
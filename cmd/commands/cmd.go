@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	assembly "github.com/molecule-man/stack-assembly"
@@ -29,8 +30,9 @@ type Commands struct {
 	}
 	NonInteractive *bool
 
-	cfg      *conf.Config
-	origArgs []string
+	cfg              *conf.Config
+	origArgs         []string
+	detailedExitCode *bool
 }
 
 func (c *Commands) RootCmd() *cobra.Command {
@@ -42,6 +44,9 @@ func (c *Commands) RootCmd() *cobra.Command {
 	out := "text"
 	c.AWSCommandsCfg.output = &out
 
+	detailedExitCode := false
+	c.detailedExitCode = &detailedExitCode
+
 	c.cfg = &conf.Config{
 		Parameters:   map[string]string{},
 		Tags:         map[string]string{},
@@ -53,10 +58,29 @@ func (c *Commands) RootCmd() *cobra.Command {
 		defaultProfile = profile
 	}
 
+	outputFormat := assembly.OutputText
+	unifiedDiff := false
+	logOpts := logOptions{}
+
 	rootCmd := &cobra.Command{
 		Use:           "stas <stack name> <template path>",
 		SilenceUsage:  true,
 		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.setUpLogging(logOpts); err != nil {
+				return err
+			}
+
+			c.SA.SetUnifiedDiff(unifiedDiff)
+
+			if outputFormat == assembly.OutputText {
+				return nil
+			}
+
+			*c.NonInteractive = true
+
+			return c.SA.SetOutputFormat(outputFormat)
+		},
 	}
 	rootCmd.PersistentFlags().StringVarP(&c.cfg.Settings.Aws.Profile, "profile", "p", defaultProfile, "AWS named profile")
 	rootCmd.PersistentFlags().StringVarP(&c.cfg.Settings.Aws.Region, "region", "r", os.Getenv("AWS_REGION"), "AWS region")
@@ -67,6 +91,26 @@ func (c *Commands) RootCmd() *cobra.Command {
 	rootCmd.PersistentFlags().BoolVarP(c.NonInteractive, "no-interaction", "n", *c.NonInteractive,
 		"Do not ask any interactive questions")
 
+	rootCmd.PersistentFlags().Var(&EnumFlag{
+		Val:   &outputFormat,
+		Enums: []string{assembly.OutputText, assembly.OutputJSON, assembly.OutputYAML},
+	}, "output", flagDescription(
+		"Output format of info, diff and sync commands. One of: text, json, yaml.",
+		" In json and yaml formats colors and interactive questions are disabled"))
+
+	rootCmd.PersistentFlags().BoolVar(&unifiedDiff, "unified-diff", false, flagDescription(
+		"Show changes of the templates as line based unified diff.",
+		" By default the templates are compared structurally and only changed",
+		" resources, properties and outputs are shown"))
+
+	rootCmd.PersistentFlags().CountVarP(&logOpts.verbosity, "verbose", "V", flagDescription(
+		"Increase verbosity. -V logs every AWS request with its duration and number",
+		" of retries, -VV logs parameters of the requests as well"))
+	rootCmd.PersistentFlags().BoolVarP(&logOpts.silent, "silent", "s", false,
+		"Print only warnings, errors and the output of the command")
+	rootCmd.PersistentFlags().StringVar(&logOpts.file, "log-file", "", flagDescription(
+		"Append log messages including debug ones to the file in JSON lines format"))
+
 	rootCmd.PersistentFlags().StringToStringVarP(&c.cfg.Parameters, "var", "v", map[string]string{},
 		"Additional variables to use as parameters in config.\nExample: -v myParam=someValue")
 
@@ -75,8 +119,11 @@ func (c *Commands) RootCmd() *cobra.Command {
 		c.syncCmd(),
 		c.deployCmd(),
 		c.diffCmd(),
+		c.outputsCmd(),
 		c.deleteCmd(),
 		c.dumpConfigCmd(),
+		c.importConfigCmd(),
+		c.gcCmd(),
 		c.cloudformationCmd(),
 	)
 
@@ -117,7 +164,7 @@ func (c Commands) deployCmd() *cobra.Command {
 				return err
 			}
 
-			_, err := c.SA.Sync(*c.cfg, *c.NonInteractive)
+			_, err := c.SA.Sync(*c.cfg, c.syncOptions())
 			return err
 		},
 	}
@@ -130,6 +177,9 @@ func (c Commands) deployCmd() *cobra.Command {
 }
 
 func (c Commands) syncCmd() *cobra.Command {
+	var outputsFile string
+
+	outputsOpts := assembly.OutputsOptions{}
 	cfgFiles := []string{}
 	cmd := &cobra.Command{
 		Use:   "sync [<ID> [<ID> ...]]",
@@ -166,43 +216,223 @@ have to be specified as well:
 				return err
 			}
 
-			for _, id := range args {
-				stack, ok := c.cfg.Stacks[id]
-				if !ok {
-					foundIds := make([]string, 0, len(c.cfg.Stacks))
-					for id := range c.cfg.Stacks {
-						foundIds = append(foundIds, id)
-					}
+			if err := c.selectStack(args); err != nil {
+				return err
+			}
 
-					assembly.MustSucceed(fmt.Errorf("ID %s is not found in the config. Found IDs: %v", id, foundIds))
-				}
+			_, err := c.SA.Sync(*c.cfg, c.syncOptions())
+			if err != nil || outputsFile == "" {
+				return err
+			}
+
+			outputsOpts.IDPath = args
 
-				*c.cfg = stack
+			return c.writeOutputsFile(outputsFile, outputsOpts)
+		},
+	}
+
+	addConfigFlag(cmd, &cfgFiles)
+
+	cmd.Flags().StringVar(&outputsFile, "outputs-file", "", flagDescription(
+		"Write outputs of the synced stacks to the file after successful sync"))
+	addOutputsFlags(cmd, &outputsOpts, "outputs-format", assembly.OutputsFormatDotenv)
+
+	return cmd
+}
+
+func (c Commands) outputsCmd() *cobra.Command {
+	var outputsFile string
+
+	opts := assembly.OutputsOptions{}
+	cfgFiles := []string{}
+
+	cmd := &cobra.Command{
+		Use:   "outputs [<ID> [<ID> ...]]",
+		Short: "Show outputs of the stacks",
+		Long: `Prints outputs of the stacks specified in the config file(s).
+
+The outputs can be printed as json, yaml, shell export statements or dotenv
+file. The stack is selected by ID the same way it is done in sync command. For
+example the following command can be used to export the outputs of the stack
+with ID db into the current shell:
+
+  eval "$(stas outputs --format shell db)"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.CfgLoader.LoadConfig(cfgFiles, c.cfg); err != nil {
+				return err
 			}
 
-			_, err := c.SA.Sync(*c.cfg, *c.NonInteractive)
-			return err
+			if err := c.selectStack(args); err != nil {
+				return err
+			}
+
+			opts.IDPath = args
+
+			if outputsFile != "" {
+				return c.writeOutputsFile(outputsFile, opts)
+			}
+
+			return c.SA.WriteOutputs(c.Cli.Writer, *c.cfg, opts)
 		},
 	}
 
 	addConfigFlag(cmd, &cfgFiles)
 
+	cmd.Flags().StringVar(&outputsFile, "file", "", flagDescription("Write outputs to the file instead of stdout"))
+	addOutputsFlags(cmd, &opts, "format", assembly.OutputsFormatJSON)
+
 	return cmd
 }
 
+func (c Commands) writeOutputsFile(fname string, opts assembly.OutputsOptions) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return c.SA.WriteOutputs(f, *c.cfg, opts)
+}
+
+func (c Commands) selectStack(ids []string) error {
+	stack, err := c.cfg.Select(ids...)
+	if err != nil {
+		return err
+	}
+
+	*c.cfg = stack
+
+	return nil
+}
+
+type logOptions struct {
+	verbosity int
+	silent    bool
+	file      string
+}
+
+// Close releases the resources acquired while the command was executed, e.g.
+// closes the log file. Nothing is written to the log file afterwards.
+func (c Commands) Close() error {
+	log := c.Cli.JSONLog
+	if log == nil {
+		return nil
+	}
+
+	c.Cli.JSONLog = nil
+	c.SA.SetLogging(c.Cli.Level, nil)
+
+	if c.AWSCommandsCfg.SA != nil {
+		c.AWSCommandsCfg.SA.SetLogging(c.Cli.Level, nil)
+	}
+
+	return log.Close()
+}
+
+// DetailedExitCode returns true if diff command is run with
+// --detailed-exitcode flag. Then the exit status is 2 for ErrChangesDetected
+// and 1 for any other error.
+func (c Commands) DetailedExitCode() bool {
+	return c.detailedExitCode != nil && *c.detailedExitCode
+}
+
+func (c Commands) setUpLogging(opts logOptions) error {
+	if opts.silent && opts.verbosity > 0 {
+		return fmt.Errorf("--silent can't be combined with --verbose: %w", ErrInvalidInput)
+	}
+
+	level := cli.LevelInfo + cli.Level(opts.verbosity)
+	if level > cli.LevelTrace {
+		level = cli.LevelTrace
+	}
+
+	if opts.silent {
+		level = cli.LevelWarn
+	}
+
+	var log *cli.JSONLog
+
+	if opts.file != "" {
+		f, err := os.OpenFile(opts.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+
+		log = cli.NewJSONLog(f)
+	}
+
+	c.Cli.Level = level
+	c.Cli.JSONLog = log
+	c.SA.SetLogging(level, log)
+
+	if c.AWSCommandsCfg.SA != nil {
+		c.AWSCommandsCfg.SA.SetLogging(level, log)
+	}
+
+	return nil
+}
+
+func (c Commands) syncOptions() assembly.SyncOptions {
+	return assembly.SyncOptions{
+		NonInteractive:   *c.NonInteractive,
+		HandleInterrupts: true,
+	}
+}
+
 func (c Commands) diffCmd() *cobra.Command {
+	format := "text"
+	opts := assembly.DiffOptions{}
 	cfgFiles := []string{}
 	cmd := &cobra.Command{
 		Use:   "diff",
 		Short: "Show diff of the stacks to be deployed",
+		Long: `Shows diff of the stacks to be deployed.
+
+With --format markdown the diff is rendered as a deployment plan that can be
+posted as a comment to a pull request. The plan contains the table of changes
+of every stack, the diffs of parameters, tags and template, and the summary
+line with the totals. Note that to get the table of changes a change set is
+created for each stack. The change set is removed right after.
+
+With --detailed-exitcode the command exits with status 0 when there are no
+changes, 2 when any stack would be changed and 1 in case of error.
+
+With --quiet only IDs of the changed stacks are printed. ID of a nested stack
+is printed as the path of IDs separated by space, so it can be passed to sync
+command as is.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := c.CfgLoader.LoadConfig(cfgFiles, c.cfg); err != nil {
 				return err
 			}
-			return c.SA.Diff(*c.cfg)
+
+			var (
+				changed []string
+				err     error
+			)
+
+			if format == "markdown" && !opts.Quiet {
+				changed, err = c.SA.Plan(*c.cfg)
+			} else {
+				changed, err = c.SA.Diff(*c.cfg, opts)
+			}
+
+			if err == nil && *c.detailedExitCode && len(changed) > 0 {
+				return ErrChangesDetected
+			}
+
+			return err
 		},
 	}
 
+	cmd.Flags().BoolVar(c.detailedExitCode, "detailed-exitcode", false, flagDescription(
+		"Exit with status 2 when there are changes, 0 when there are no changes and 1 on error"))
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, flagDescription(
+		"Print only IDs of the stacks that would be changed"))
+
+	cmd.Flags().Var(&EnumFlag{Val: &format, Enums: []string{"text", "markdown"}}, "format",
+		flagDescription("Format of the diff. One of: text, markdown"))
+
 	cmd.Flags().StringVar(&c.cfg.Name, "stack-name", "", flagDescription("Stack name"))
 	cmd.Flags().StringVar(&c.cfg.Path, "template-path", "", flagDescription("Path to Cloudformation template body"))
 	addConfigFlag(cmd, &cfgFiles)
@@ -242,8 +472,7 @@ func (c Commands) dumpConfigCmd() *cobra.Command {
 				return err
 			}
 
-			c.dumpCfg(format)
-			return nil
+			return c.dumpCfg(format)
 		},
 	}
 	dumpCmd.Flags().StringVarP(&format, "format", "f", "yaml", "One of: yaml, toml, json")
@@ -252,6 +481,82 @@ func (c Commands) dumpConfigCmd() *cobra.Command {
 	return dumpCmd
 }
 
+func (c Commands) importConfigCmd() *cobra.Command {
+	opts := assembly.ImportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "import-config [<stack name> ...]",
+		Short: "Generate config from already deployed stacks",
+		Long: `Generates config file out of the stacks that are already deployed.
+
+The stacks to import are either listed by name or selected by the name prefix.
+The template of every imported stack is written to the templates directory and
+the stacks are added to the config together with their parameters, tags,
+capabilities, role ARN and notification ARNs. Dependencies between the stacks
+are inferred from the exports imported with Fn::ImportValue.
+
+  stas import-config --prefix myapp-`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && opts.Prefix == "" {
+				return fmt.Errorf("either stack names or --prefix has to be provided: %w", ErrInvalidInput)
+			}
+
+			if err := c.CfgLoader.InitConfig(c.cfg); err != nil {
+				return err
+			}
+
+			prov, err := c.cfg.AWS()
+			if err != nil {
+				return err
+			}
+
+			opts.StackNames = args
+
+			return c.SA.ImportConfig(prov.CF, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Prefix, "prefix", "", flagDescription("Import all the stacks which names start with the prefix"))
+	cmd.Flags().StringVar(&opts.TemplatesDir, "templates-dir", "cf-tpls", flagDescription("Directory to write templates into"))
+	cmd.Flags().StringVarP(&opts.ConfigFile, "output-file", "o", "stack-assembly.yaml", flagDescription("Path of the generated config file"))
+	cmd.Flags().BoolVar(&opts.Force, "force", false, flagDescription("Overwrite config file if it already exists"))
+
+	return cmd
+}
+
+func (c Commands) gcCmd() *cobra.Command {
+	opts := assembly.GCOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove leftovers of interrupted runs",
+		Long: `Lists and removes the leftovers of interrupted runs: the change sets created
+by stas that were never executed, the stacks that stay in REVIEW_IN_PROGRESS
+state because their change set was abandoned and the temporary buckets
+created to upload templates. Only the resources older than --older-than are
+collected so that the runs that are still in progress are not affected.
+
+  stas gc --older-than 24h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.CfgLoader.InitConfig(c.cfg); err != nil {
+				return err
+			}
+
+			prov, err := c.cfg.AWS()
+			if err != nil {
+				return err
+			}
+
+			return c.SA.GC(prov, opts, *c.NonInteractive)
+		},
+	}
+
+	cmd.Flags().DurationVar(&opts.OlderThan, "older-than", time.Hour, flagDescription("Collect only the resources older than this"))
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, flagDescription("Only list the resources that would be removed"))
+
+	return cmd
+}
+
 func (c Commands) cloudformationCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cloudformation",
@@ -284,7 +589,7 @@ func (c Commands) cfDeployCmd() *cobra.Command {
 			if err := c.CfgLoader.InitConfig(c.cfg); err != nil {
 				return err
 			}
-			_, err := c.AWSCommandsCfg.SA.Sync(*c.cfg, *c.NonInteractive)
+			_, err := c.AWSCommandsCfg.SA.Sync(*c.cfg, c.syncOptions())
 			return err
 		},
 	}
@@ -313,8 +618,8 @@ func (c Commands) cfDeployCmd() *cobra.Command {
 
 	c.cfSharedFlags(cmd)
 
-	assembly.MustSucceed(cmd.MarkFlagRequired("stack-name"))
-	assembly.MustSucceed(cmd.MarkFlagRequired("template-file"))
+	mustMarkFlagRequired(cmd, ("stack-name"))
+	mustMarkFlagRequired(cmd, ("template-file"))
 
 	return cmd
 }
@@ -343,7 +648,7 @@ func (c Commands) cfCreateCmd() *cobra.Command {
 
 	c.cfCreateUpdateFlags(cmd)
 
-	assembly.MustSucceed(cmd.MarkFlagRequired("stack-name"))
+	mustMarkFlagRequired(cmd, ("stack-name"))
 
 	return cmd
 }
@@ -375,7 +680,7 @@ func (c Commands) cfUpdateCmd() *cobra.Command {
 
 	cmd.Flags().Bool("no-use-previous-template", false, "This flag is ignored")
 
-	assembly.MustSucceed(cmd.MarkFlagRequired("stack-name"))
+	mustMarkFlagRequired(cmd, ("stack-name"))
 
 	return cmd
 }
@@ -400,7 +705,7 @@ func (c Commands) cfCreateUpdateFunc(cmd *cobra.Command) func(*cobra.Command, []
 			return err
 		}
 
-		stacks, err := c.AWSCommandsCfg.SA.Sync(*c.cfg, *c.NonInteractive)
+		stacks, err := c.AWSCommandsCfg.SA.Sync(*c.cfg, c.syncOptions())
 		if err != nil {
 			return err
 		}
@@ -477,20 +782,45 @@ func (c Commands) cfSharedFlags(cmd *cobra.Command) {
 		"The formatting style for command output. Either text or json"))
 }
 
-func (c Commands) dumpCfg(format string) {
+func (c Commands) dumpCfg(format string) error {
 	out := c.Cli.Writer
 
 	switch format {
 	case "yaml", "yml":
-		assembly.MustSucceed(yaml.NewEncoder(out).Encode(c.cfg))
+		return yaml.NewEncoder(out).Encode(c.cfg)
 	case "json":
 		enc := json.NewEncoder(out)
 		enc.SetIndent("", "  ")
-		assembly.MustSucceed(enc.Encode(c.cfg))
+
+		return enc.Encode(c.cfg)
 	case "toml":
-		assembly.MustSucceed(toml.NewEncoder(out).Encode(c.cfg))
-	default:
-		assembly.Terminate("unknown format: " + format)
+		return toml.NewEncoder(out).Encode(c.cfg)
+	}
+
+	return fmt.Errorf("unknown format: %s", format)
+}
+
+func addOutputsFlags(cmd *cobra.Command, opts *assembly.OutputsOptions, formatFlag, defaultFormat string) {
+	opts.Format = defaultFormat
+	cmd.Flags().Var(&EnumFlag{
+		Val: &opts.Format,
+		Enums: []string{
+			assembly.OutputsFormatJSON,
+			assembly.OutputsFormatYAML,
+			assembly.OutputsFormatShell,
+			assembly.OutputsFormatDotenv,
+		},
+	}, formatFlag, flagDescription("Format of the outputs. One of: json, yaml, shell, dotenv"))
+
+	cmd.Flags().BoolVar(&opts.PrefixKeys, "prefix-keys", false, flagDescription(
+		"Prefix output keys with the ID of the stack they belong to"))
+}
+
+// mustMarkFlagRequired panics if the flag is not defined, which is a
+// programming error.
+func mustMarkFlagRequired(cmd *cobra.Command, name string) {
+	if err := cmd.MarkFlagRequired(name); err != nil {
+		panic(err)
 	}
 }
 
@@ -523,3 +853,7 @@ func (f *EnumFlag) String() string { return *f.Val }
 
 var ErrNotRunnable = errors.New("command is not runnable")
 var ErrInvalidInput = errors.New("invalid input")
+
+// ErrChangesDetected is returned by diff command run with --detailed-exitcode
+// flag when any stack would be changed.
+var ErrChangesDetected = errors.New("changes detected")
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assembly "github.com/molecule-man/stack-assembly"
+	"github.com/molecule-man/stack-assembly/aws"
+	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/molecule-man/stack-assembly/conf"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFlagsDontShadowGlobalOnes(t *testing.T) {
+	c := &Commands{Cli: &cli.CLI{}}
+	root := c.RootCmd()
+
+	var check func(cmd *cobra.Command)
+
+	check = func(cmd *cobra.Command) {
+		cmd.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+			assert.Nil(t, root.PersistentFlags().Lookup(f.Name),
+				"flag --%s of %s shadows the global one", f.Name, cmd.CommandPath())
+
+			if f.Shorthand != "" {
+				assert.Nil(t, root.PersistentFlags().ShorthandLookup(f.Shorthand),
+					"flag -%s of %s shadows the global one", f.Shorthand, cmd.CommandPath())
+			}
+		})
+
+		for _, sub := range cmd.Commands() {
+			check(sub)
+		}
+	}
+
+	for _, cmd := range root.Commands() {
+		check(cmd)
+	}
+}
+
+func TestCloseClosesLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stas")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	c := &Commands{
+		Cli: &cli.CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}},
+		SA:  assembly.New(&cli.CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}}),
+	}
+
+	require.NoError(t, c.setUpLogging(logOptions{file: filepath.Join(dir, "log.json")}))
+	require.NotNil(t, c.Cli.JSONLog)
+
+	require.NoError(t, c.Close())
+	assert.Nil(t, c.Cli.JSONLog)
+}
+
+func TestDetailedExitCodeIsReportedForFailedDiff(t *testing.T) {
+	for _, detailed := range []bool{true, false} {
+		c := &Commands{
+			Cli:       &cli.CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}},
+			SA:        assembly.New(&cli.CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}}),
+			CfgLoader: conf.NewLoader(&conf.OsFS{}, &aws.Provider{}),
+		}
+
+		args := []string{"diff", "-c", filepath.Join(os.TempDir(), "stas-missing-config.yaml")}
+		if detailed {
+			args = append(args, "--detailed-exitcode")
+		}
+
+		root := c.RootCmd()
+		root.SetArgs(args)
+
+		assert.Error(t, root.Execute())
+		assert.Equal(t, detailed, c.DetailedExitCode())
+	}
+}
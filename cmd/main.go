@@ -21,15 +21,22 @@ func main() {
 		Errorer: os.Stderr,
 	}
 
-	nonInteractive := !isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd())
+	nonInteractive := !isTerminal(os.Stdout)
+
+	sa := assembly.New(console)
+	sa.SetLiveProgress(isTerminal(os.Stdout))
+
+	awsProvider := &aws.Provider{
+		Logger: console,
+		TokenPrompt: func(mfaSerial string) (string, error) {
+			return console.Fask(os.Stderr, "Enter MFA code for %s: ", mfaSerial)
+		},
+	}
 
 	cmd := commands.Commands{
-		SA:  assembly.New(console),
-		Cli: console,
-		CfgLoader: conf.NewLoader(
-			&conf.OsFS{},
-			&aws.Provider{},
-		),
+		SA:             sa,
+		Cli:            console,
+		CfgLoader:      conf.NewLoader(&conf.OsFS{}, awsProvider),
 		NonInteractive: &nonInteractive,
 	}
 
@@ -38,36 +45,67 @@ func main() {
 		Writer:  os.Stderr,
 		Errorer: os.Stderr,
 	})
+	cmd.AWSCommandsCfg.SA.SetLiveProgress(isTerminal(os.Stderr))
 
 	cmd.NormalizeAwscliParamsIfNeeded()
 
 	err := cmd.RootCmd().Execute()
 
-	if err != nil {
-		switch {
-		case errors.Is(err, commands.ErrNotRunnable), strings.HasPrefix(err.Error(), "unknown command"):
-			if os.Getenv("STAS_SUPPRESS_CMD_NOT_FOUND_ERROR") != "yes" {
-				console.Error(err.Error())
-			}
+	if cleanupErr := awsProvider.Cleanup(); cleanupErr != nil {
+		console.Warnf("Error while cleaning up: %s", cleanupErr)
+	}
 
-			os.Exit(2)
-		case errors.Is(err, commands.ErrAwsDropInArgParsingFailed):
-			console.Error(err.Error())
-			os.Exit(3)
-		case strings.HasPrefix(err.Error(), "unknown flag"):
-			console.Error(err.Error())
-			os.Exit(4)
-		case strings.HasPrefix(err.Error(), "invalid argument"):
-			console.Error(err.Error())
-			os.Exit(5)
-		case errors.Is(err, commands.ErrInvalidInput):
-			console.Error(err.Error())
-			os.Exit(6)
-		default:
+	code := exitCode(console, err, cmd.DetailedExitCode())
+
+	if closeErr := cmd.Close(); closeErr != nil {
+		console.Warnf("Error while closing log file: %s", closeErr)
+	}
+
+	os.Exit(code)
+}
+
+// exitCode prints the error and returns the exit status the error results in.
+// With detailed exit code the errors are not told apart, status 2 is reserved
+// for the changes detected by diff.
+func exitCode(console *cli.CLI, err error, detailed bool) int {
+	if err == nil {
+		return 0
+	}
+
+	switch {
+	case errors.Is(err, commands.ErrChangesDetected):
+		return 2
+	case detailed:
+		console.Error(err.Error())
+		return 1
+	case errors.Is(err, assembly.ErrInterrupted):
+		// the interruption is already reported by sync
+		return 130
+	case errors.Is(err, commands.ErrNotRunnable), strings.HasPrefix(err.Error(), "unknown command"):
+		if os.Getenv("STAS_SUPPRESS_CMD_NOT_FOUND_ERROR") != "yes" {
 			console.Error(err.Error())
-			os.Exit(1)
 		}
+
+		return 2
+	case errors.Is(err, commands.ErrAwsDropInArgParsingFailed):
+		console.Error(err.Error())
+		return 3
+	case strings.HasPrefix(err.Error(), "unknown flag"):
+		console.Error(err.Error())
+		return 4
+	case strings.HasPrefix(err.Error(), "invalid argument"):
+		console.Error(err.Error())
+		return 5
+	case errors.Is(err, commands.ErrInvalidInput):
+		console.Error(err.Error())
+		return 6
 	}
 
-	assembly.MustSucceed(err)
+	console.Error(err.Error())
+
+	return 1
+}
+
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
 }
@@ -1,11 +1,14 @@
 package conf
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -20,6 +23,7 @@ import (
 type settingsConfig struct {
 	Aws        aws.Config
 	S3Settings aws.S3Settings
+	Wait       awscf.WaitSettings
 }
 
 // Config is a struct holding stacks configurations.
@@ -53,18 +57,39 @@ type Config struct {
 
 	Stacks map[string]Config `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
 
-	aws AwsProv
+	// Targets are the regions and accounts the stack is deployed to. At load
+	// time the stack is replaced with the group of stacks, one per target.
+	Targets []Target `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	// Concurrency limits the number of targets synced in parallel. Zero means
+	// no limit.
+	Concurrency int `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	// StackSet turns the stack into a StackSet deployed to the accounts (or
+	// organizational units) and regions of its deployment targets.
+	StackSet *awscf.StackSetSettings `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	aws    AwsProv
+	fanOut bool
+	target string
+	idPath []string
 }
 
-func (cfg Config) StackConfigsSortedByExecOrder() ([]Config, error) {
-	stackCfgs := make([]Config, len(cfg.Stacks))
+// StackIDsSortedByExecOrder returns IDs of the nested stacks sorted in the
+// order they have to be deployed in.
+func (cfg Config) StackIDsSortedByExecOrder() ([]string, error) {
 	dg := depgraph.DepGraph{}
 
 	for id, stackCfg := range cfg.Stacks {
 		dg.Add(id, stackCfg.DependsOn)
 	}
 
-	orderedIds, err := dg.Resolve()
+	return dg.Resolve()
+}
+
+func (cfg Config) StackConfigsSortedByExecOrder() ([]Config, error) {
+	stackCfgs := make([]Config, len(cfg.Stacks))
+
+	orderedIds, err := cfg.StackIDsSortedByExecOrder()
 	if err != nil {
 		return stackCfgs, err
 	}
@@ -85,24 +110,122 @@ func (cfg Config) ChangeSets() ([]*awscf.ChangeSet, error) {
 	}
 
 	for i, s := range ss {
-		chSets[i] = s.ChangeSet()
+		if chSets[i], err = s.ChangeSet(); err != nil {
+			return chSets, err
+		}
 	}
 
 	return chSets, nil
 }
 
-func (cfg Config) Stack() *awscf.Stack {
-	prov := cfg.aws.Must(cfg.Settings.Aws)
+// Select returns the config of the nested stack found by the path of IDs.
+// The config itself is returned if no IDs are given.
+func (cfg Config) Select(ids ...string) (Config, error) {
+	for _, id := range ids {
+		stack, ok := cfg.Stacks[id]
+
+		// the target of the stack can be selected by its ID without selecting
+		// the stack first
+		if i := strings.Index(id, TargetSeparator); !ok && i > 0 {
+			stack, ok = cfg.Stacks[id[:i]].Stacks[id]
+		}
+
+		if !ok {
+			foundIds := make([]string, 0, len(cfg.Stacks))
+			for id := range cfg.Stacks {
+				foundIds = append(foundIds, id)
+			}
+
+			sort.Strings(foundIds)
+
+			return cfg, fmt.Errorf("ID %s is not found in the config. Found IDs: %v", id, foundIds)
+		}
+
+		cfg = stack
+	}
+
+	return cfg, nil
+}
+
+// IDPath returns the path of IDs leading to the config from the root of the
+// loaded config. The path of the root config is empty.
+func (cfg Config) IDPath() []string {
+	return cfg.idPath
+}
+
+func assignIDPaths(cfg *Config, idPath []string) {
+	cfg.idPath = idPath
+
+	for id, stack := range cfg.Stacks {
+		assignIDPaths(&stack, append(append([]string{}, idPath...), id))
+		cfg.Stacks[id] = stack
+	}
+}
+
+// HasTemplate returns true if the config describes a stack to be deployed:
+// the template is given by body, url or the deployed one is reused.
+func (cfg Config) HasTemplate() bool {
+	return cfg.Body != "" || cfg.URL != "" || cfg.UsePreviousTemplate
+}
+
+// IsStackSet returns true if the config describes a StackSet rather than a
+// stack.
+func (cfg Config) IsStackSet() bool {
+	return cfg.StackSet != nil
+}
+
+// AWS returns aws clients configured according to the stack settings.
+func (cfg Config) AWS() (*aws.AWS, error) {
+	return cfg.aws.New(cfg.Settings.Aws)
+}
+
+// Stack returns the stack described by the config.
+func (cfg Config) Stack() (*awscf.Stack, error) {
+	prov, err := cfg.AWS()
+	if err != nil {
+		return nil, err
+	}
 
 	return awscf.NewStack(
 		cfg.Name,
 		prov.CF,
-		aws.NewS3Uploader(prov.S3UploadManager, prov.S3, cfg.Settings.S3Settings),
-	)
+		prov.S3Uploader(cfg.Settings.S3Settings),
+	).WithWaitSettings(cfg.Settings.Wait), nil
+}
+
+// StackSetDeployment returns the stack set described by the config.
+func (cfg Config) StackSetDeployment() (*awscf.StackSet, error) {
+	if cfg.StackSet == nil {
+		return nil, fmt.Errorf("%s is not a stack set", cfg.Name)
+	}
+
+	prov, err := cfg.AWS()
+	if err != nil {
+		return nil, err
+	}
+
+	return awscf.NewStackSet(
+		cfg.Name,
+		prov.CF,
+		prov.S3Uploader(cfg.Settings.S3Settings),
+	).
+		WithWaitSettings(cfg.Settings.Wait).
+		WithTemplate(cfg.Body, cfg.URL).
+		WithParameters(cfg.Parameters).
+		WithTags(cfg.Tags).
+		WithCapabilities(cfg.Capabilities).
+		WithSettings(*cfg.StackSet), nil
 }
 
-func (cfg Config) ChangeSet() *awscf.ChangeSet {
-	return cfg.Stack().
+// ChangeSet returns the change set that brings the stack to the state
+// described by the config.
+func (cfg Config) ChangeSet() (*awscf.ChangeSet, error) {
+	stack, err := cfg.Stack()
+	if err != nil {
+		return nil, err
+	}
+
+	return stack.
 		ChangeSet(cfg.Body).
 		WithTemplateURL(cfg.URL).
 		WithParameters(cfg.Parameters).
@@ -113,7 +236,7 @@ func (cfg Config) ChangeSet() *awscf.ChangeSet {
 		WithClientToken(cfg.ClientToken).
 		WithNotificationARNs(cfg.NotificationARNs).
 		WithUsePrevTpl(cfg.UsePreviousTemplate).
-		WithResourceTypes(cfg.ResourceTypes)
+		WithResourceTypes(cfg.ResourceTypes), nil
 }
 
 func (cfg *Config) initAwsSettings() {
@@ -122,6 +245,7 @@ func (cfg *Config) initAwsSettings() {
 		s.aws = cfg.aws
 
 		s.Settings.S3Settings.Merge(cfg.Settings.S3Settings)
+		s.Settings.Wait.Merge(cfg.Settings.Wait)
 
 		s.initAwsSettings()
 
@@ -129,8 +253,8 @@ func (cfg *Config) initAwsSettings() {
 	}
 }
 
+// AwsProv provides aws clients configured according to the settings.
 type AwsProv interface {
-	Must(cfg aws.Config) *aws.AWS
 	New(cfg aws.Config) (*aws.AWS, error)
 }
 
@@ -152,6 +276,23 @@ func (l Loader) LoadConfig(cfgFiles []string, cfg *Config) error {
 	return l.InitConfig(cfg)
 }
 
+// LoadConfigData loads config from data in one of the formats: yaml, json or
+// toml. Templates referenced by path are read from the file system of the
+// loader.
+func (l Loader) LoadConfigData(data []byte, format string, cfg *Config) error {
+	rawCfg := make(map[string]interface{})
+
+	if err := parseConfigData(bytes.NewReader(data), format, &rawCfg); err != nil {
+		return fmt.Errorf("error occurred while parsing config: %w", err)
+	}
+
+	if err := decodeRawConfig(cfg, rawCfg); err != nil {
+		return err
+	}
+
+	return l.InitConfig(cfg)
+}
+
 func (l Loader) InitConfig(cfg *Config) error {
 	cfg.aws = l.aws
 
@@ -160,6 +301,20 @@ func (l Loader) InitConfig(cfg *Config) error {
 		return err
 	}
 
+	if len(cfg.Targets) > 0 {
+		return errors.New("targets can only be set for the stacks listed in `stacks`")
+	}
+
+	if err = validateStackSets(cfg.Name, *cfg); err != nil {
+		return err
+	}
+
+	if err = expandTargets(cfg); err != nil {
+		return err
+	}
+
+	assignIDPaths(cfg, nil)
+
 	cfg.initAwsSettings()
 
 	return l.applyTemplating(cfg)
@@ -229,6 +384,10 @@ func (l Loader) decodeConfigs(mainConfig *Config, cfgFiles []string) error {
 		mainRawCfg = merged.(map[string]interface{})
 	}
 
+	return decodeRawConfig(mainConfig, mainRawCfg)
+}
+
+func decodeRawConfig(mainConfig *Config, mainRawCfg map[string]interface{}) error {
 	if d, ok := mainRawCfg["definitions"]; ok {
 		delete(mainRawCfg, "definitions")
 
@@ -246,6 +405,7 @@ func (l Loader) decodeConfigs(mainConfig *Config, cfgFiles []string) error {
 	}
 
 	config := mapstructure.DecoderConfig{
+		DecodeHook:  decodeHookCmd,
 		ErrorUnused: true,
 		Result:      mainConfig,
 	}
@@ -303,19 +463,29 @@ func (l Loader) parseFile(filename string, cfg *map[string]interface{}) error {
 	defer f.Close()
 
 	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".yaml", ".yml":
-		d := yaml.NewDecoder(f)
+	if err = parseConfigData(f, strings.TrimPrefix(ext, "."), cfg); errors.Is(err, errUnsupportedFormat) {
+		return fmt.Errorf("extension %s is not supported", ext)
+	}
+
+	return err
+}
+
+var errUnsupportedFormat = errors.New("unsupported config format")
+
+func parseConfigData(r io.Reader, format string, cfg *map[string]interface{}) error {
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		d := yaml.NewDecoder(r)
 		return d.Decode(cfg)
-	case ".json":
-		d := json.NewDecoder(f)
+	case "json":
+		d := json.NewDecoder(r)
 		return d.Decode(cfg)
-	case ".toml":
-		_, err := toml.DecodeReader(f, cfg)
+	case "toml":
+		_, err := toml.DecodeReader(r, cfg)
 		return err
 	}
 
-	return fmt.Errorf("extension %s is not supported", ext)
+	return fmt.Errorf("%w: %s", errUnsupportedFormat, format)
 }
 
 func merge(x1, x2 interface{}) interface{} {
@@ -8,7 +8,9 @@ import (
 	"testing"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go/aws"
 	"github.com/molecule-man/stack-assembly/aws"
+	"github.com/molecule-man/stack-assembly/awscf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -215,3 +217,310 @@ func makeTestFile(t *testing.T, ext, content string) (string, func()) {
 func loader() *Loader {
 	return NewLoader(&OsFS{}, &aws.Provider{})
 }
+
+func TestWaitSettingsAreInherited(t *testing.T) {
+	fpath, cleanup := makeTestFile(t, ".yaml", `
+settings:
+  wait:
+    timeoutInMinutes: 90
+    pollIntervalSeconds: 5
+stacks:
+  cdn:
+    settings:
+      wait:
+        timeoutInMinutes: 120
+`)
+	defer cleanup()
+
+	cfg := Config{}
+	require.NoError(t, loader().decodeConfigs(&cfg, []string{fpath}))
+
+	cfg.initAwsSettings()
+
+	assert.Equal(t, awscf.WaitSettings{TimeoutInMinutes: 120, PollIntervalSeconds: 5}, cfg.Stacks["cdn"].Settings.Wait)
+}
+
+func TestAssumeRoleSettingsAreInherited(t *testing.T) {
+	fpath, cleanup := makeTestFile(t, ".yaml", `
+settings:
+  aws:
+    assumeRoleArn: arn:aws:iam::111111111111:role/deployer
+    externalId: ext
+    sessionName: ci
+    mfaSerial: arn:aws:iam::000000000000:mfa/dev
+stacks:
+  prod:
+    settings:
+      aws:
+        assumeRoleArn: arn:aws:iam::222222222222:role/deployer
+        durationSeconds: 1800
+    stacks:
+      db:
+        name: db
+  staging:
+    name: staging
+`)
+	defer cleanup()
+
+	cfg := Config{}
+	require.NoError(t, loader().decodeConfigs(&cfg, []string{fpath}))
+
+	cfg.initAwsSettings()
+
+	assert.Equal(t, aws.Config{
+		AssumeRoleArn:   "arn:aws:iam::222222222222:role/deployer",
+		SessionName:     "ci",
+		DurationSeconds: 1800,
+		MFASerial:       "arn:aws:iam::000000000000:mfa/dev",
+	}, cfg.Stacks["prod"].Stacks["db"].Settings.Aws)
+
+	assert.Equal(t, aws.Config{
+		AssumeRoleArn: "arn:aws:iam::111111111111:role/deployer",
+		ExternalID:    "ext",
+		SessionName:   "ci",
+		MFASerial:     "arn:aws:iam::000000000000:mfa/dev",
+	}, cfg.Stacks["staging"].Settings.Aws)
+}
+
+type fakeAwsProv struct{}
+
+func (fakeAwsProv) New(cfg aws.Config) (*aws.AWS, error) {
+	region := cfg.Region
+	if region == "" {
+		region = "eu-west-1"
+	}
+
+	return &aws.AWS{AccountID: "123456789012", Region: region}, nil
+}
+
+func TestHTTPSettingsAndEndpointsAreInherited(t *testing.T) {
+	fpath, cleanup := makeTestFile(t, ".yaml", `
+settings:
+  aws:
+    endpoint: http://localhost:4566
+    httpTimeoutSeconds: 30
+    maxRetries: 3
+    proxy: http://proxy:3128
+    s3ForcePathStyle: true
+    endpoints:
+      sts: https://sts.amazonaws.com
+stacks:
+  app:
+    name: app
+    settings:
+      aws:
+        maxRetries: 10
+        endpoints:
+          s3: http://localhost:9000
+`)
+	defer cleanup()
+
+	cfg := Config{}
+	require.NoError(t, loader().decodeConfigs(&cfg, []string{fpath}))
+
+	cfg.initAwsSettings()
+
+	assert.Equal(t, aws.Config{
+		Endpoint: "http://localhost:4566",
+		Endpoints: aws.Endpoints{
+			S3:  "http://localhost:9000",
+			STS: "https://sts.amazonaws.com",
+		},
+		HTTPTimeoutSeconds: 30,
+		MaxRetries:         10,
+		Proxy:              "http://proxy:3128",
+		S3ForcePathStyle:   awssdk.Bool(true),
+	}, cfg.Stacks["app"].Settings.Aws)
+}
+
+func TestExplicitFalseOverridesInheritedS3ForcePathStyle(t *testing.T) {
+	fpath, cleanup := makeTestFile(t, ".yaml", `
+settings:
+  aws:
+    s3ForcePathStyle: true
+stacks:
+  app:
+    name: app
+  bucket:
+    name: bucket
+    settings:
+      aws:
+        s3ForcePathStyle: false
+`)
+	defer cleanup()
+
+	cfg := Config{}
+	require.NoError(t, loader().decodeConfigs(&cfg, []string{fpath}))
+
+	cfg.initAwsSettings()
+
+	assert.Equal(t, awssdk.Bool(true), cfg.Stacks["app"].Settings.Aws.S3ForcePathStyle)
+	assert.Equal(t, awssdk.Bool(false), cfg.Stacks["bucket"].Settings.Aws.S3ForcePathStyle)
+}
+
+func TestLoadConfigData(t *testing.T) {
+	data := `
+parameters:
+  Env: dev
+stacks:
+  app:
+    name: app-{{ .Params.Env }}-{{ .AWS.Region }}
+    body: "{}"
+`
+
+	cfg := Config{}
+	require.NoError(t, NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg))
+
+	assert.Equal(t, "app-dev-eu-west-1", cfg.Stacks["app"].Name)
+	assert.Equal(t, map[string]string{"Env": "dev"}, cfg.Stacks["app"].Parameters)
+}
+
+func TestAccountIDIsAvailableInTemplates(t *testing.T) {
+	data := `
+stacks:
+  app:
+    name: app-{{ .AWS.AccountID }}
+    body: "{}"
+`
+
+	cfg := Config{}
+	require.NoError(t, NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg))
+
+	assert.Equal(t, "app-123456789012", cfg.Stacks["app"].Name)
+}
+
+func TestLoadConfigDataFailsOnUnknownFormat(t *testing.T) {
+	cfg := Config{}
+	err := NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte("{}"), "ini", &cfg)
+	assert.Error(t, err)
+}
+
+func TestSelect(t *testing.T) {
+	cfg := Config{Stacks: map[string]Config{
+		"parent": {Name: "parent", Stacks: map[string]Config{
+			"child": {Name: "child"},
+		}},
+		"other": {Name: "other"},
+	}}
+
+	selected, err := cfg.Select("parent", "child")
+	require.NoError(t, err)
+	assert.Equal(t, "child", selected.Name)
+
+	selected, err = cfg.Select()
+	require.NoError(t, err)
+	assert.Equal(t, cfg, selected)
+
+	_, err = cfg.Select("child")
+	assert.EqualError(t, err, "ID child is not found in the config. Found IDs: [other parent]")
+}
+
+func TestTargetsAreExpanded(t *testing.T) {
+	data := `
+stacks:
+  db:
+    name: db
+    body: "{}"
+  app:
+    name: app-{{ .AWS.Region }}
+    body: "{}"
+    dependsOn: [db]
+    concurrency: 2
+    parameters:
+      Size: small
+    targets:
+      - region: eu-west-1
+      - region: us-east-1
+        assumeRoleArn: arn:aws:iam::111111111111:role/deployer
+        parameters:
+          Size: large
+`
+
+	cfg := Config{}
+	require.NoError(t, NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg))
+
+	group := cfg.Stacks["app"]
+	assert.True(t, group.FanOut())
+	assert.False(t, group.HasTemplate())
+	assert.Equal(t, []string{"db"}, group.DependsOn)
+	assert.Equal(t, 2, group.Concurrency)
+	require.Len(t, group.Stacks, 2)
+
+	eu := group.Stacks["app@eu-west-1"]
+	assert.Equal(t, "app-eu-west-1", eu.Name)
+	assert.Equal(t, "app-eu-west-1@eu-west-1", eu.DisplayName())
+	assert.Equal(t, "small", eu.Parameters["Size"])
+	assert.Empty(t, eu.DependsOn)
+
+	us, err := cfg.Select("app@us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "app-us-east-1", us.Name)
+	assert.Equal(t, "large", us.Parameters["Size"])
+	assert.Equal(t, "arn:aws:iam::111111111111:role/deployer", us.Settings.Aws.AssumeRoleArn)
+	assert.Equal(t, "us-east-1", us.Settings.Aws.Region)
+}
+
+func TestTargetsMustHaveUniqueIDs(t *testing.T) {
+	data := `
+stacks:
+  app:
+    name: app
+    body: "{}"
+    targets:
+      - region: eu-west-1
+        profile: dev
+      - region: eu-west-1
+        profile: prod
+`
+
+	cfg := Config{}
+	err := NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg)
+	assert.EqualError(t, err, "stack app has more than one target with id eu-west-1")
+}
+
+func TestStackSetIsLoaded(t *testing.T) {
+	data := `
+stacks:
+  baseline:
+    name: baseline
+    body: "{}"
+    capabilities: [CAPABILITY_IAM]
+    stackSet:
+      removeDroppedInstances: true
+      deploymentTargets:
+        accounts: ["111111111111", "222222222222"]
+        regions: [eu-west-1, us-east-1]
+      operationPreferences:
+        maxConcurrentCount: 2
+        failureToleranceCount: 1
+`
+
+	cfg := Config{}
+	require.NoError(t, NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg))
+
+	stackSet := cfg.Stacks["baseline"]
+	require.True(t, stackSet.IsStackSet())
+	assert.True(t, stackSet.StackSet.RemoveDroppedInstances)
+	assert.Equal(t, []string{"111111111111", "222222222222"}, stackSet.StackSet.DeploymentTargets.Accounts)
+	assert.Equal(t, []string{"eu-west-1", "us-east-1"}, stackSet.StackSet.DeploymentTargets.Regions)
+	require.NotNil(t, stackSet.StackSet.OperationPreferences)
+	assert.Equal(t, int64(2), *stackSet.StackSet.OperationPreferences.MaxConcurrentCount)
+}
+
+func TestStackSetCantHaveTargets(t *testing.T) {
+	data := `
+stacks:
+  baseline:
+    name: baseline
+    body: "{}"
+    stackSet:
+      deploymentTargets:
+        accounts: ["111111111111"]
+    targets:
+      - region: eu-west-1
+`
+
+	cfg := Config{}
+	err := NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg)
+	assert.EqualError(t, err, "stack set baseline can't have targets, use stackSet.deploymentTargets instead")
+}
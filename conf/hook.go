@@ -1,28 +1,124 @@
 package conf
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
-type hookCmd []string
+// HookCmd is a command executed at a certain stage of sync. In the config it
+// can be given as a list of the program and its arguments, as a string that is
+// executed with `sh -c` or as a map with the fields of HookCmd.
+type HookCmd struct {
+	Args  []string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Shell string   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
 
-type HookCmds []hookCmd
+	// Dir is the working directory of the command. The command is executed in
+	// the current directory if it's empty.
+	Dir string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	// TimeoutSeconds limits the time the command can run. The command is
+	// killed when it runs out of time. Zero means no limit.
+	TimeoutSeconds int `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+type HookCmds []HookCmd
+
+// HookEnv describes the deployment the hooks are executed for. It's passed to
+// the hook commands as STAS_* environment variables.
+type HookEnv struct {
+	StackName string
+	IDPath    []string
+	Region    string
+	AccountID string
+
+	// Change is set for the hooks executed before and after the stack is
+	// created or updated.
+	Change *HookChange
+
+	// Outputs are the outputs of the stack. They are only known to the hooks
+	// executed after the stack is synced.
+	Outputs map[string]string
+}
+
+// HookChange is the change of the stack the hooks are executed around.
+type HookChange struct {
+	ChangeSetID string
+	IsUpdate    bool
+}
+
+var envKeyRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Vars returns the environment variables passed to the hook commands.
+func (e HookEnv) Vars() []string {
+	vars := []string{
+		"STAS_STACK_NAME=" + e.StackName,
+		"STAS_ID_PATH=" + strings.Join(e.IDPath, " "),
+		"STAS_REGION=" + e.Region,
+		"STAS_ACCOUNT_ID=" + e.AccountID,
+	}
+
+	if e.Change != nil {
+		vars = append(vars,
+			"STAS_CHANGE_SET_ID="+e.Change.ChangeSetID,
+			fmt.Sprintf("STAS_IS_UPDATE=%t", e.Change.IsUpdate),
+		)
+	}
+
+	keys := make([]string, 0, len(e.Outputs))
+	for k := range e.Outputs {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		vars = append(vars, "STAS_OUTPUT_"+envKeyRe.ReplaceAllString(k, "_")+"="+e.Outputs[k])
+	}
+
+	return vars
+}
 
 type HookError struct {
-	cmd hookCmd
+	cmd HookCmd
 	err error
-	out []byte
 }
 
 func (e *HookError) Error() string {
-	return fmt.Sprintf("hook command %v failed with err: %v, output:\n%s", e.cmd, e.err, string(e.out))
+	return fmt.Sprintf("hook command %v failed with err: %v", e.cmd.argv(), e.err)
 }
 
-func (h HookCmds) Exec() error {
+func (e *HookError) Unwrap() error {
+	return e.err
+}
+
+// Exec executes the commands one by one with the variables of env added to
+// the environment. Both stdout and stderr of the commands are written to out
+// as they are produced. The output is discarded if out is nil. The command
+// that is running when ctx is canceled is killed together with the processes
+// it started.
+func (h HookCmds) Exec(ctx context.Context, env HookEnv, out io.Writer) error {
+	if out == nil {
+		out = ioutil.Discard
+	}
+
+	vars := append(os.Environ(), env.Vars()...)
+
 	for _, hc := range h {
-		err := hc.exec()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := hc.exec(ctx, vars, out)
 		if err != nil {
 			return err
 		}
@@ -31,17 +127,90 @@ func (h HookCmds) Exec() error {
 	return nil
 }
 
-func (h hookCmd) exec() error {
-	if len(h) == 0 {
+func (h HookCmd) argv() []string {
+	if h.Shell != "" {
+		return []string{"sh", "-c", h.Shell}
+	}
+
+	return h.Args
+}
+
+func (h HookCmd) exec(ctx context.Context, vars []string, out io.Writer) error {
+	argv := h.argv()
+	if len(argv) == 0 {
 		return errors.New("hook command is empty")
 	}
 
-	cmd := h[0]
-	out, err := exec.Command(cmd, h[1:]...).CombinedOutput()
+	if h.Shell != "" && len(h.Args) > 0 {
+		return fmt.Errorf("hook command %v has both args and shell, only one of them is allowed", h.Args)
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = h.Dir
+	cmd.Env = vars
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	// the command runs in its own process group, so that the processes it
+	// starts are killed together with it when it runs out of time or is
+	// canceled
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return &HookError{h, err}
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+
+	if h.TimeoutSeconds > 0 {
+		timer := time.NewTimer(time.Duration(h.TimeoutSeconds) * time.Second)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-timeout:
+		killProcessGroup(cmd)
+		<-done
+
+		err = fmt.Errorf("timed out after %ds", h.TimeoutSeconds)
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+
+		err = ctx.Err()
+	}
 
 	if err != nil {
-		return &HookError{h, err, out}
+		return &HookError{h, err}
 	}
 
 	return nil
 }
+
+// decodeHookCmd lets the hook command be given as the list of arguments or as
+// the shell script in the config.
+func decodeHookCmd(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(HookCmd{}) {
+		return data, nil
+	}
+
+	switch from.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"shell": data}, nil
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"args": data}, nil
+	}
+
+	return data, nil
+}
@@ -0,0 +1,86 @@
+package conf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookCmdsCanBeGivenInAnyForm(t *testing.T) {
+	data := `
+stacks:
+  app:
+    name: app
+    body: "{}"
+    hooks:
+      post:
+        - ["echo", "done"]
+        - echo $STAS_STACK_NAME
+        - shell: make migrate
+          dir: db
+          timeoutSeconds: 300
+`
+
+	cfg := Config{}
+	require.NoError(t, NewLoader(&OsFS{}, fakeAwsProv{}).LoadConfigData([]byte(data), "yaml", &cfg))
+
+	assert.Equal(t, HookCmds{
+		{Args: []string{"echo", "done"}},
+		{Shell: "echo $STAS_STACK_NAME"},
+		{Shell: "make migrate", Dir: "db", TimeoutSeconds: 300},
+	}, cfg.Stacks["app"].Hooks.Post)
+	assert.Equal(t, []string{"app"}, cfg.Stacks["app"].IDPath())
+}
+
+func TestHookCmdsGetDeploymentInEnv(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	err := HookCmds{
+		{Shell: `echo "$STAS_STACK_NAME $STAS_ID_PATH $STAS_IS_UPDATE $STAS_OUTPUT_Db_Host"`},
+		{Args: []string{"sh", "-c", "echo failure >&2"}},
+	}.Exec(context.Background(), HookEnv{
+		StackName: "db",
+		IDPath:    []string{"staging", "db"},
+		Change:    &HookChange{ChangeSetID: "chset", IsUpdate: true},
+		Outputs:   map[string]string{"Db.Host": "localhost"},
+	}, out)
+
+	require.NoError(t, err)
+	assert.Equal(t, "db staging db true localhost\nfailure\n", out.String())
+}
+
+func TestHookCmdTimesOut(t *testing.T) {
+	err := HookCmds{{Args: []string{"sleep", "5"}, TimeoutSeconds: 1}}.Exec(context.Background(), HookEnv{}, nil)
+
+	assert.EqualError(t, err, "hook command [sleep 5] failed with err: timed out after 1s")
+}
+
+func TestShellHookCmdTimesOutWithProcessesItStarted(t *testing.T) {
+	out := &bytes.Buffer{}
+	start := time.Now()
+
+	err := HookCmds{{Shell: "sleep 5; echo x", TimeoutSeconds: 1}}.Exec(context.Background(), HookEnv{}, out)
+
+	assert.EqualError(t, err, "hook command [sh -c sleep 5; echo x] failed with err: timed out after 1s")
+	assert.Less(t, int64(time.Since(start)), int64(3*time.Second))
+	assert.Empty(t, out.String())
+}
+
+func TestHookCmdIsKilledWhenCanceled(t *testing.T) {
+	out := &bytes.Buffer{}
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	err := HookCmds{{Shell: "sleep 5; echo x"}}.Exec(ctx, HookEnv{}, out)
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, int64(time.Since(start)), int64(3*time.Second))
+	assert.Empty(t, out.String())
+}
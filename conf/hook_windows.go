@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package conf
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(*exec.Cmd) {}
+
+// killProcessGroup kills the command. The processes started by the command
+// are not tracked on windows, so they keep running.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,32 @@
+package conf
+
+import (
+	"fmt"
+)
+
+// validateStackSets checks that the stack sets are not combined with the
+// features that only make sense for the ordinary stacks.
+func validateStackSets(id string, cfg Config) error {
+	if cfg.IsStackSet() {
+		switch {
+		case cfg.Name == "":
+			return fmt.Errorf("stack set %s must have name", id)
+		case len(cfg.Stacks) > 0:
+			return fmt.Errorf("stack set %s can't have nested stacks", id)
+		case len(cfg.Targets) > 0:
+			return fmt.Errorf("stack set %s can't have targets, use stackSet.deploymentTargets instead", id)
+		case len(cfg.Blocked) > 0:
+			return fmt.Errorf("resources of stack set %s can't be blocked", id)
+		case cfg.UsePreviousTemplate || !cfg.HasTemplate():
+			return fmt.Errorf("stack set %s must have template", id)
+		}
+	}
+
+	for nestedID, stack := range cfg.Stacks {
+		if err := validateStackSets(nestedID, stack); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
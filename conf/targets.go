@@ -0,0 +1,134 @@
+package conf
+
+import (
+	"fmt"
+)
+
+// TargetSeparator separates ID of the stack and ID of its target in ID of the
+// stack expanded from the target, e.g. app@eu-west-1.
+const TargetSeparator = "@"
+
+// Target is a region and/or account the stack is deployed to. ID of the target
+// defaults to its region.
+type Target struct {
+	ID            string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Region        string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Profile       string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	AssumeRoleArn string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	ExternalID    string            `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Parameters    map[string]string `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+}
+
+func (t Target) id() string {
+	if t.ID != "" {
+		return t.ID
+	}
+
+	return t.Region
+}
+
+// FanOut returns true if the nested stacks of the config are the targets of
+// one stack and can be synced in parallel.
+func (cfg Config) FanOut() bool {
+	return cfg.fanOut
+}
+
+// DisplayName returns the name of the stack followed by the ID of the target
+// if the stack is expanded from the target, e.g. app@eu-west-1. Stacks of
+// different targets usually have the same name, so it's used to tell them
+// apart in the output.
+func (cfg Config) DisplayName() string {
+	if cfg.target == "" {
+		return cfg.Name
+	}
+
+	return cfg.Name + TargetSeparator + cfg.target
+}
+
+// expandTargets replaces every stack having targets with the group of stacks,
+// one per target. The stacks of the group are the copies of the original
+// stack with the aws settings and parameters of the target applied. The group
+// keeps ID, dependencies and settings of the original stack, so the other
+// stacks can still depend on it.
+func expandTargets(cfg *Config) error {
+	for id, stack := range cfg.Stacks {
+		if err := expandTargets(&stack); err != nil {
+			return err
+		}
+
+		if len(stack.Targets) > 0 {
+			group, err := expandStackTargets(id, stack)
+			if err != nil {
+				return err
+			}
+
+			stack = group
+		}
+
+		cfg.Stacks[id] = stack
+	}
+
+	return nil
+}
+
+func expandStackTargets(id string, stack Config) (Config, error) {
+	if len(stack.Stacks) > 0 {
+		return stack, fmt.Errorf("stack %s has targets and nested stacks, only one of them is allowed", id)
+	}
+
+	group := Config{
+		Parameters:  stack.Parameters,
+		DependsOn:   stack.DependsOn,
+		Settings:    stack.Settings,
+		Concurrency: stack.Concurrency,
+		Stacks:      make(map[string]Config, len(stack.Targets)),
+		fanOut:      true,
+	}
+
+	for _, t := range stack.Targets {
+		if t.id() == "" {
+			return stack, fmt.Errorf("target of stack %s must have either region or id", id)
+		}
+
+		targetID := id + TargetSeparator + t.id()
+		if _, ok := group.Stacks[targetID]; ok {
+			return stack, fmt.Errorf("stack %s has more than one target with id %s", id, t.id())
+		}
+
+		group.Stacks[targetID] = targetStack(stack, t)
+	}
+
+	return group, nil
+}
+
+func targetStack(stack Config, t Target) Config {
+	s := stack
+	s.target = t.id()
+	s.Targets = nil
+	s.Concurrency = 0
+	s.DependsOn = nil
+
+	s.Parameters = make(map[string]string, len(stack.Parameters)+len(t.Parameters))
+	for k, v := range stack.Parameters {
+		s.Parameters[k] = v
+	}
+
+	for k, v := range t.Parameters {
+		s.Parameters[k] = v
+	}
+
+	if t.Region != "" {
+		s.Settings.Aws.Region = t.Region
+	}
+
+	if t.Profile != "" {
+		s.Settings.Aws.Profile = t.Profile
+	}
+
+	if t.AssumeRoleArn != "" {
+		s.Settings.Aws.AssumeRoleArn = t.AssumeRoleArn
+		s.Settings.Aws.ExternalID = t.ExternalID
+	}
+
+	return s
+}
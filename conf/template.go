@@ -8,16 +8,25 @@ import (
 
 	awssdk "github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/molecule-man/stack-assembly/aws"
 )
 
 type tplData struct {
-	AWS struct {
-		AccountID string
-		Region    string
-	}
+	AWS    tplAWS
 	Params map[string]string
 }
 
+// tplAWS exposes the aws settings to the templates. The account id is
+// requested only if the template refers to it.
+type tplAWS struct {
+	Region string
+	aws    *aws.AWS
+}
+
+func (a tplAWS) AccountID() (string, error) {
+	return a.aws.Account()
+}
+
 func (l Loader) applyTemplating(cfg *Config) error {
 	var err error
 	*cfg, err = l.templatizeStackConfig(*cfg, tplData{Params: map[string]string{}})
@@ -71,8 +80,7 @@ func (l Loader) updateAwsSettings(data *tplData, cfg Config) error {
 		return err
 	}
 
-	data.AWS.Region = awsSetup.Region
-	data.AWS.AccountID = awsSetup.AccountID
+	data.AWS = tplAWS{Region: awsSetup.Region, aws: awsSetup}
 
 	return nil
 }
@@ -0,0 +1,227 @@
+package assembly
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+)
+
+// Types of events written by console observer when machine-readable output is
+// enabled.
+const (
+	syncEventNoChanges        = "NoChanges"
+	syncEventChangeSetCreated = "ChangeSetCreated"
+	syncEventChanges          = "Changes"
+	syncEventStackEvent       = "StackEvent"
+	syncEventResult           = "Result"
+	syncEventStackSetChanges  = "StackSetChanges"
+	syncEventOperation        = "StackSetOperation"
+	syncEventInstanceStatus   = "StackInstanceStatus"
+)
+
+type syncEvent struct {
+	Event       string
+	Stack       string
+	ChangeSetID string            `json:",omitempty"`
+	Operation   string            `json:",omitempty"`
+	Changes     []awscf.Change    `json:",omitempty"`
+	StackEvent  *awscf.StackEvent `json:",omitempty"`
+	Status      string            `json:",omitempty"`
+	Error       string            `json:",omitempty"`
+
+	OperationID string                         `json:",omitempty"`
+	Create      []awscf.InstanceBatch          `json:",omitempty"`
+	Delete      []awscf.InstanceBatch          `json:",omitempty"`
+	Instance    *awscf.StackSetOperationResult `json:",omitempty"`
+}
+
+// consoleObserver writes the events either as human readable messages or as
+// machine-readable documents. It reads the settings of SA when the event is
+// received, so that the settings changed after New are respected.
+type consoleObserver struct {
+	sa *SA
+
+	mu sync.Mutex
+	// views are the live progress views of the stacks whose events are being
+	// streamed. The view is dropped as soon as anything else is printed for the
+	// stack, since it can only be redrawn when it's the last printed thing.
+	views map[string]*progressView
+}
+
+func newConsoleObserver(sa *SA) *consoleObserver {
+	return &consoleObserver{sa: sa, views: map[string]*progressView{}}
+}
+
+func (o *consoleObserver) Notify(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	sa := *o.sa
+	logger := sa.cli.PrefixedLogger(fmt.Sprintf("[%s] ", e.StackName()))
+
+	switch e := e.(type) {
+	case StackEventsReceived:
+		o.showEvents(sa, e, logger)
+		return
+	case StackEventsFailed:
+		o.showEventsErr(sa, e, logger)
+		return
+	}
+
+	delete(o.views, e.StackName())
+
+	switch e := e.(type) {
+	case StackSelected:
+		if e.Operation == OperationSync {
+			logger.Info("Synchronizing template")
+		}
+	case ChangeSetCreated:
+		o.showChangeSet(sa, e, logger)
+	case StackCompleted:
+		if e.NoChanges {
+			logger.Info("No changes to be synchronized")
+			o.emit(sa, syncEvent{Event: syncEventNoChanges, Stack: e.Stack})
+		} else {
+			logger.Print(sa.cli.Color.Success("Synchronization is complete"))
+		}
+
+		o.emit(sa, syncEvent{Event: syncEventResult, Stack: e.Stack, Status: "COMPLETE"})
+	case StackFailed:
+		var failureErr *awscf.FailureError
+		if errors.As(e.Err, &failureErr) && len(failureErr.Failures) > 0 {
+			logger.Error(awscf.FailureReport(failureErr.Failures))
+		}
+
+		o.emit(sa, syncEvent{Event: syncEventResult, Stack: e.Stack, Status: "FAILED", Error: e.Err.Error()})
+	case StackSetChangesDetected:
+		o.showStackSetChanges(sa, e, logger)
+	case StackSetOperationStarted:
+		logger.Infof("Operation %s is started: %s %s", e.Operation.ID, e.Operation.Action, e.Operation.Batch)
+		o.emit(sa, syncEvent{
+			Event:       syncEventOperation,
+			Stack:       e.Stack,
+			OperationID: e.Operation.ID,
+			Operation:   e.Operation.Action,
+		})
+	case StackInstanceStatusChanged:
+		if sa.structured() {
+			r := e.Result
+			o.emit(sa, syncEvent{Event: syncEventInstanceStatus, Stack: e.Stack, OperationID: r.OperationID, Instance: &r})
+		} else {
+			logger.Print(sa.sprintInstanceResult(e.Result))
+		}
+	case DeleteFinished:
+		if e.Err == nil {
+			logger.Print(sa.cli.Color.Success("Stack is deleted successfully"))
+		}
+	}
+}
+
+func (o *consoleObserver) emit(sa SA, e syncEvent) {
+	if !sa.structured() {
+		return
+	}
+
+	if err := sa.docs.encode(e); err != nil {
+		sa.cli.Warnf("failed to write %s event: %s", e.Event, err)
+	}
+}
+
+func (o *consoleObserver) showChangeSet(sa SA, e ChangeSetCreated, logger *cli.Logger) {
+	logger.Infof("Change set is created: %s", e.ChangeSetID)
+
+	if !sa.structured() {
+		sa.showChanges(e.Changes)
+		return
+	}
+
+	operation := "CREATE"
+	if e.IsUpdate {
+		operation = "UPDATE"
+	}
+
+	o.emit(sa, syncEvent{Event: syncEventChangeSetCreated, Stack: e.Stack, ChangeSetID: e.ChangeSetID, Operation: operation})
+	o.emit(sa, syncEvent{Event: syncEventChanges, Stack: e.Stack, Changes: e.Changes})
+}
+
+func (o *consoleObserver) showStackSetChanges(sa SA, e StackSetChangesDetected, logger *cli.Logger) {
+	if !sa.structured() {
+		sa.showStackSetChanges(e.Plan, e.Sections, logger)
+		return
+	}
+
+	operation := ""
+
+	switch {
+	case !e.Plan.Exists:
+		operation = "CREATE"
+	case e.Plan.Update:
+		operation = "UPDATE"
+	}
+
+	o.emit(sa, syncEvent{
+		Event:     syncEventStackSetChanges,
+		Stack:     e.Stack,
+		Operation: operation,
+		Create:    e.Plan.Create,
+		Delete:    e.Plan.Delete,
+	})
+}
+
+func (o *consoleObserver) showEvents(sa SA, e StackEventsReceived, logger *cli.Logger) {
+	if sa.liveProgress && !sa.structured() {
+		view := o.view(sa, e.Stack)
+		view.warning = ""
+		view.update(e.Events)
+		o.render(view, logger)
+
+		return
+	}
+
+	writer := cli.NewColWriter(sa.cli.Writer, " ")
+
+	for _, se := range e.Events {
+		if sa.structured() {
+			se := se
+			o.emit(sa, syncEvent{Event: syncEventStackEvent, Stack: e.Stack, StackEvent: &se})
+
+			continue
+		}
+
+		logger.Fprint(writer, sa.sprintEvent(se))
+	}
+
+	writer.Flush()
+}
+
+func (o *consoleObserver) showEventsErr(sa SA, e StackEventsFailed, logger *cli.Logger) {
+	if sa.liveProgress && !sa.structured() {
+		view := o.view(sa, e.Stack)
+		view.warning = fmt.Sprintf("got an error while requesting stack events: %s", e.Err)
+		o.render(view, logger)
+
+		return
+	}
+
+	logger.Warnf("got an error while requesting stack events: %s", e.Err)
+}
+
+func (o *consoleObserver) view(sa SA, stack string) *progressView {
+	view, ok := o.views[stack]
+	if !ok {
+		view = sa.newProgressView(stack)
+		o.views[stack] = view
+	}
+
+	return view
+}
+
+func (o *consoleObserver) render(view *progressView, logger *cli.Logger) {
+	if err := view.render(time.Now()); err != nil {
+		logger.Warnf("failed to render progress: %s", err)
+	}
+}
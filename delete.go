@@ -42,21 +42,33 @@ func (a *deleteAction) delete(cfg conf.Config) error {
 		return nil
 	}
 
-	logger := a.cli.PrefixedLogger(fmt.Sprintf("[%s] ", cfg.Name))
+	logger := a.cli.PrefixedLogger(fmt.Sprintf("[%s] ", cfg.DisplayName()))
 
-	stack := cfg.Stack()
+	if cfg.IsStackSet() {
+		logger.Warn("Deletion of stack sets is not supported. Skipping")
+		return nil
+	}
+
+	a.sa.notify(StackSelected{Stack: cfg.DisplayName(), Operation: OperationDelete})
+
+	stack, err := cfg.Stack()
+	if err != nil {
+		return err
+	}
 
 	exists, err := stack.Exists()
-	MustSucceed(err)
+	if err != nil {
+		return err
+	}
 
 	if !exists {
 		logger.Info("Stack doesn't exist")
 		return nil
 	}
 
-	logger.Warnf("Stack %s is about to be deleted", cfg.Name)
+	logger.Warnf("Stack %s is about to be deleted", cfg.DisplayName())
 
-	err = a.ask(stack)
+	err = a.ask(cfg.DisplayName(), stack)
 
 	if errors.Is(err, errSkipDelete) {
 		return nil
@@ -66,65 +78,29 @@ func (a *deleteAction) delete(cfg conf.Config) error {
 		return err
 	}
 
-	err = stack.Delete()
-	if err != nil {
-		return err
-	}
+	a.sa.notify(DeleteStarted{Stack: cfg.DisplayName()})
 
-	logger.Print(a.cli.Color.Success("Stack is deleted successfully"))
+	err = stack.Delete()
+	a.sa.notify(DeleteFinished{Stack: cfg.DisplayName(), Err: err})
 
-	return nil
+	return err
 }
 
-func (a *deleteAction) ask(stack *awscf.Stack) error {
+func (a *deleteAction) ask(name string, stack *awscf.Stack) error {
 	if a.nonInteractive {
 		return nil
 	}
 
-	continueDelete := false
-	for !continueDelete {
-		var actionErr error
-
-		err := a.cli.Prompt([]cli.PromptCmd{{
-			Description:   "[d]elete",
-			TriggerInputs: []string{"d", "delete"},
-			Action: func() {
-				continueDelete = true
-			},
-		}, {
-			Description:   "[a]ll (delete all without asking again)",
-			TriggerInputs: []string{"a", "all"},
-			Action: func() {
-				a.nonInteractive = true
-				continueDelete = true
-			},
-		}, {
-			Description:   "[i]nfo (show stack info)",
-			TriggerInputs: []string{"i", "info"},
-			Action: func() {
-				actionErr = a.sa.Info(stack)
-			},
-		}, {
-			Description:   "[s]kip",
-			TriggerInputs: []string{"s", "skip"},
-			Action: func() {
-				actionErr = errSkipDelete
-			},
-		}, {
-			Description:   "[q]uit",
-			TriggerInputs: []string{"q", "quit"},
-			Action: func() {
-				a.cli.Error("Interrupted by user")
-				actionErr = errors.New("deletion is canceled")
-			},
-		}})
-		if err != nil && !errors.Is(err, cli.ErrPromptCommandIsNotKnown) {
-			return err
-		}
+	decision, err := a.sa.approver.ApproveDelete(DeleteApproval{Stack: name, Deployed: stack})
+	if err != nil {
+		return err
+	}
 
-		if actionErr != nil {
-			return actionErr
-		}
+	switch decision {
+	case DeleteAllConfirmed:
+		a.nonInteractive = true
+	case DeleteSkipped:
+		return errSkipDelete
 	}
 
 	return nil
@@ -1,23 +1,89 @@
 package assembly
 
 import (
+	"strings"
+
 	"github.com/molecule-man/stack-assembly/awscf"
 	"github.com/molecule-man/stack-assembly/conf"
 )
 
-func (sa SA) Diff(cfg conf.Config) error {
-	for _, childCfg := range cfg.Stacks {
-		err := sa.Diff(childCfg)
+// DiffOptions controls the output of Diff.
+type DiffOptions struct {
+	// Quiet disables printing of the diffs. Only IDs of the changed stacks
+	// are printed.
+	Quiet bool
+}
+
+// SetUnifiedDiff switches the diff of the templates to the line based unified
+// diff.
+func (sa *SA) SetUnifiedDiff(enabled bool) {
+	sa.unifiedDiff = enabled
+}
+
+func (sa SA) differ() awscf.ChSetDiff {
+	return awscf.ChSetDiff{Color: sa.cli.Color, Unified: sa.unifiedDiff}
+}
+
+// Diff shows differences between the deployed stacks and the config. The
+// stacks are visited in the same order they are synced. IDs of the stacks that
+// would be changed by sync are returned. ID of a nested stack is the path of
+// IDs separated by space, the same way they are passed to sync command.
+func (sa SA) Diff(cfg conf.Config, opts DiffOptions) ([]string, error) {
+	changed := []string{}
+	err := sa.diffRecursively(cfg, []string{}, opts, &changed)
+
+	return changed, err
+}
+
+func (sa SA) diffRecursively(cfg conf.Config, idPath []string, opts DiffOptions, changed *[]string) error {
+	if cfg.HasTemplate() {
+		diffStack := sa.diffStack
+		if cfg.IsStackSet() {
+			diffStack = sa.diffStackSet
+		}
+
+		hasChanges, err := diffStack(cfg, opts.Quiet)
 		if err != nil {
 			return err
 		}
+
+		if hasChanges {
+			id := strings.Join(idPath, " ")
+			if id == "" {
+				id = cfg.Name
+			}
+
+			*changed = append(*changed, id)
+
+			if err := sa.printChangedStack(id, cfg.DisplayName(), opts.Quiet); err != nil {
+				return err
+			}
+		}
 	}
 
-	if cfg.Body == "" {
-		return nil
+	ids, err := cfg.StackIDsSortedByExecOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		nestedPath := append(append([]string{}, idPath...), id)
+
+		if err := sa.diffRecursively(cfg.Stacks[id], nestedPath, opts, changed); err != nil {
+			return err
+		}
 	}
 
-	cs := cfg.ChangeSet()
+	return nil
+}
+
+func (sa SA) diffStack(cfg conf.Config, quiet bool) (bool, error) {
+	sa.notify(StackSelected{Stack: cfg.DisplayName(), Operation: OperationDiff})
+
+	cs, err := cfg.ChangeSet()
+	if err != nil {
+		return false, err
+	}
 
 	defer func() {
 		if closeErr := cs.Close(); closeErr != nil {
@@ -25,12 +91,43 @@ func (sa SA) Diff(cfg conf.Config) error {
 		}
 	}()
 
-	diff, err := awscf.ChSetDiff{Color: sa.cli.Color}.Diff(cs)
+	if sa.structured() {
+		diff, err := sa.differ().StructuredDiff(cs)
+		if err != nil {
+			return false, err
+		}
+
+		if !quiet {
+			err = sa.docs.encode(diff)
+		}
+
+		return diff.HasChanges(), err
+	}
+
+	differ := sa.differ()
+
+	sections, err := differ.Sections(cs)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	if !quiet && (len(sections) > 0 || cs.UsesPreviousTemplate()) {
+		sa.cli.Print(differ.RenderStack(cs, sections))
+	}
+
+	return len(sections) > 0, nil
+}
+
+func (sa SA) printChangedStack(id, name string, quiet bool) error {
+	if !quiet {
+		return nil
+	}
+
+	if sa.structured() {
+		return sa.docs.encode(struct{ ID, Stack string }{id, name})
 	}
 
-	sa.cli.Print(diff)
+	sa.cli.Print(id)
 
 	return nil
 }
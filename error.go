@@ -6,12 +6,20 @@ import (
 	"github.com/molecule-man/stack-assembly/cli"
 )
 
+// MustSucceed terminates the program if err is not nil.
+//
+// Deprecated: the functions of the package return errors instead of
+// terminating the program. MustSucceed is kept for the command line tool and
+// should not be used by the code that embeds stack-assembly.
 func MustSucceed(err error) {
 	if err != nil {
 		Terminate(err.Error())
 	}
 }
 
+// Terminate prints the message to stderr and exits with non zero status.
+//
+// Deprecated: see MustSucceed.
 func Terminate(msg string) {
 	cli := cli.CLI{Errorer: os.Stderr}
 	cli.Error(msg)
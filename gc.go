@@ -0,0 +1,201 @@
+package assembly
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/molecule-man/stack-assembly/aws"
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+)
+
+// GCOptions controls which leftovers are collected by GC.
+type GCOptions struct {
+	// OlderThan protects the resources that might still be in use by
+	// the stas processes running at the moment.
+	OlderThan time.Duration
+	DryRun    bool
+}
+
+type garbage struct {
+	kind    string
+	name    string
+	created time.Time
+	remove  func() error
+}
+
+// GC removes the leftovers of the interrupted stas runs: change sets created
+// by stas that were never executed, stacks that stay in REVIEW_IN_PROGRESS
+// state because their only change set was abandoned and the buckets that were
+// created to upload templates.
+func (sa SA) GC(prov *aws.AWS, opts GCOptions, nonInteractive bool) error {
+	threshold := time.Now().Add(-opts.OlderThan)
+
+	items, err := collectGarbage(prov, threshold)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		sa.cli.Print(sa.cli.Color.Success("Nothing to collect"))
+		return nil
+	}
+
+	w := cli.NewColWriter(sa.cli.Writer, " ")
+
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", item.kind, item.name, item.created.Format(time.RFC3339))
+	}
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	if !nonInteractive {
+		if err = sa.confirmGC(); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range items {
+		if err = item.remove(); err != nil {
+			return err
+		}
+
+		sa.cli.Print(sa.cli.Color.Success(fmt.Sprintf("Deleted %s %s", item.kind, item.name)))
+	}
+
+	return nil
+}
+
+func (sa SA) confirmGC() error {
+	for {
+		var actionErr error
+
+		confirmed := false
+
+		err := sa.cli.Prompt([]cli.PromptCmd{{
+			Description:   "[d]elete",
+			TriggerInputs: []string{"d", "delete"},
+			Action: func() {
+				confirmed = true
+			},
+		}, {
+			Description:   "[q]uit",
+			TriggerInputs: []string{"q", "quit"},
+			Action: func() {
+				sa.cli.Error("Interrupted by user")
+				actionErr = errors.New("gc is canceled")
+			},
+		}})
+		if err != nil && !errors.Is(err, cli.ErrPromptCommandIsNotKnown) {
+			return err
+		}
+
+		if actionErr != nil || confirmed {
+			return actionErr
+		}
+	}
+}
+
+func collectGarbage(prov *aws.AWS, threshold time.Time) ([]garbage, error) {
+	items := []garbage{}
+
+	infos, err := awscf.ListStacks(prov.CF)
+	if err != nil {
+		return items, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	for _, info := range infos {
+		// change sets of nested stacks are managed by the change sets of
+		// their parents
+		if info.ParentID() != "" {
+			continue
+		}
+
+		chSets, err := awscf.ListChangeSets(prov.CF, info.Name())
+		if err != nil {
+			return items, err
+		}
+
+		if info.InReviewState() {
+			if isAbandonedReviewStack(info, chSets, threshold) {
+				stack := awscf.NewStack(info.Name(), prov.CF, nil)
+				items = append(items, garbage{"stack", info.Name(), info.CreationTime(), stack.Delete})
+			}
+
+			continue
+		}
+
+		for _, chSet := range chSets {
+			if isStaleChangeSet(chSet, threshold) {
+				id := chSet.ID
+				items = append(items, garbage{
+					kind:    "change set",
+					name:    fmt.Sprintf("%s (%s)", chSet.Name, chSet.StackName),
+					created: chSet.CreationTime,
+					remove:  func() error { return awscf.DeleteChangeSet(prov.CF, id) },
+				})
+			}
+		}
+	}
+
+	buckets, err := aws.ListTmpBuckets(prov.S3)
+	if err != nil {
+		return items, err
+	}
+
+	for _, b := range buckets {
+		if b.CreationDate.Before(threshold) {
+			name := b.Name
+			items = append(items, garbage{
+				kind:    "bucket",
+				name:    name,
+				created: b.CreationDate,
+				remove:  func() error { return aws.DeleteTmpBucket(prov.S3, name) },
+			})
+		}
+	}
+
+	return items, nil
+}
+
+func isStaleChangeSet(chSet awscf.ChangeSetSummary, threshold time.Time) bool {
+	if !strings.HasPrefix(chSet.Name, awscf.ChangeSetNamePrefix) || !chSet.CreationTime.Before(threshold) {
+		return false
+	}
+
+	switch chSet.ExecutionStatus {
+	case cloudformation.ExecutionStatusExecuteInProgress, cloudformation.ExecutionStatusExecuteComplete:
+		return false
+	}
+
+	return true
+}
+
+// isAbandonedReviewStack reports whether the stack was created by stas only to
+// hold the change set. Review stacks having change sets created by other tools
+// are left untouched.
+func isAbandonedReviewStack(info awscf.StackInfo, chSets []awscf.ChangeSetSummary, threshold time.Time) bool {
+	if !info.CreationTime().Before(threshold) {
+		return false
+	}
+
+	for _, chSet := range chSets {
+		if !isStaleChangeSet(chSet, threshold) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,93 @@
+package assembly
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/molecule-man/stack-assembly/conf"
+)
+
+// execHooks executes the hooks of the config. The details of the deployment
+// are passed to the hooks as environment variables and their output is
+// printed as it's produced. The outputs of the stack are passed to the hooks
+// if the stack is given, so it should only be given to the hooks executed
+// after the stack is synced. HookStarted and HookFinished are emitted around
+// the execution. The running hook is killed and ErrInterrupted is returned
+// when ctx is canceled.
+func (sa SA) execHooks(ctx context.Context, stage string, hooks conf.HookCmds, cfg conf.Config, change *conf.HookChange, stack *awscf.Stack) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	sa.notify(HookStarted{Stack: cfg.DisplayName(), Stage: stage})
+
+	err := sa.runHooks(ctx, hooks, cfg, change, stack)
+	if ctx.Err() != nil {
+		err = ErrInterrupted
+	}
+
+	sa.notify(HookFinished{Stack: cfg.DisplayName(), Stage: stage, Err: err})
+
+	return err
+}
+
+func (sa SA) runHooks(ctx context.Context, hooks conf.HookCmds, cfg conf.Config, change *conf.HookChange, stack *awscf.Stack) error {
+
+	env := conf.HookEnv{
+		StackName: cfg.Name,
+		IDPath:    cfg.IDPath(),
+		Change:    change,
+	}
+
+	prefix := ""
+	if cfg.Name != "" {
+		prefix = fmt.Sprintf("[%s] ", cfg.DisplayName())
+	}
+
+	logger := sa.cli.PrefixedLogger(prefix)
+
+	// the hooks that don't need the account (or don't deal with aws at all)
+	// keep working when it can't be found out
+	env.Region, env.AccountID = hookAccount(cfg, logger)
+
+	if stack != nil {
+		info, err := stack.Info()
+		if err != nil {
+			return err
+		}
+
+		env.Outputs = make(map[string]string, len(info.Outputs()))
+		for _, out := range info.Outputs() {
+			env.Outputs[out.Key] = out.Value
+		}
+	}
+
+	out := logger.Writer()
+
+	err := hooks.Exec(ctx, env, out)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// hookAccount returns the region and the account the config is deployed to.
+// The values that can't be found out are left empty.
+func hookAccount(cfg conf.Config, logger *cli.Logger) (string, string) {
+	awsClients, err := cfg.AWS()
+	if err != nil {
+		logger.Debug("aws settings are not passed to the hooks", cli.Fields{"err": err})
+		return cfg.Settings.Aws.Region, ""
+	}
+
+	accountID, err := awsClients.Account()
+	if err != nil {
+		logger.Debug("account id is not passed to the hooks", cli.Fields{"err": err})
+	}
+
+	return awsClients.Region, accountID
+}
@@ -0,0 +1,236 @@
+package assembly
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/molecule-man/stack-assembly/awscf"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// noEchoMask is the value returned by cloudformation in place of NoEcho
+// parameters.
+const noEchoMask = "****"
+
+// ImportOptions specifies which deployed stacks are imported and where the
+// generated config and templates are written.
+type ImportOptions struct {
+	StackNames   []string
+	Prefix       string
+	TemplatesDir string
+	ConfigFile   string
+	Force        bool
+}
+
+type importedStack struct {
+	Name             string            `yaml:"name"`
+	Path             string            `yaml:"path"`
+	Parameters       map[string]string `yaml:"parameters,omitempty"`
+	Tags             map[string]string `yaml:"tags,omitempty"`
+	Capabilities     []string          `yaml:"capabilities,omitempty"`
+	RoleARN          string            `yaml:"roleARN,omitempty"`
+	NotificationARNs []string          `yaml:"notificationARNs,omitempty"`
+	DependsOn        []string          `yaml:"dependsOn,omitempty"`
+}
+
+// ImportConfig generates stack-assembly config out of already deployed
+// stacks.
+func (sa SA) ImportConfig(cf cloudformationiface.CloudFormationAPI, opts ImportOptions) error {
+	if _, err := os.Stat(opts.ConfigFile); err == nil && !opts.Force {
+		return fmt.Errorf("config file %s already exists. Use --force to overwrite it", opts.ConfigFile)
+	}
+
+	infos, err := sa.stacksToImport(cf, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(infos) == 0 {
+		return errors.New("no stacks found to import")
+	}
+
+	exporters := map[string]string{}
+
+	for _, info := range infos {
+		for _, out := range info.Outputs() {
+			if out.ExportName != "" {
+				exporters[out.ExportName] = importedStackID(info.Name(), opts.Prefix)
+			}
+		}
+	}
+
+	if err = os.MkdirAll(opts.TemplatesDir, 0755); err != nil {
+		return err
+	}
+
+	stacks := make(map[string]importedStack, len(infos))
+
+	for _, info := range infos {
+		id := importedStackID(info.Name(), opts.Prefix)
+		logger := sa.cli.PrefixedLogger(fmt.Sprintf("[%s] ", info.Name()))
+
+		body, err := awscf.NewStack(info.Name(), cf, nil).Body()
+		if err != nil {
+			return err
+		}
+
+		stack := importedStack{
+			Name:             info.Name(),
+			Path:             filepath.Join(opts.TemplatesDir, id+templateExt(body)),
+			Parameters:       map[string]string{},
+			Tags:             map[string]string{},
+			Capabilities:     info.Capabilities(),
+			RoleARN:          info.RoleARN(),
+			NotificationARNs: info.NotificationARNs(),
+		}
+
+		for _, p := range info.Parameters() {
+			if p.Val == noEchoMask {
+				logger.Warnf("Parameter %s is NoEcho. Its value has to be added to the config manually", p.Key)
+				continue
+			}
+
+			stack.Parameters[p.Key] = p.Val
+		}
+
+		for _, t := range info.Tags() {
+			stack.Tags[t.Key] = t.Val
+		}
+
+		imports, err := awscf.TemplateImports(body)
+		if err != nil {
+			logger.Warnf("Not able to infer dependencies: %s", err)
+		}
+
+		stack.DependsOn = importedStackDeps(id, imports, exporters)
+
+		if err = ioutil.WriteFile(stack.Path, []byte(body), 0644); err != nil {
+			return err
+		}
+
+		logger.Infof("Template is written to %s", stack.Path)
+
+		stacks[id] = stack
+	}
+
+	return sa.writeImportedConfig(opts.ConfigFile, stacks)
+}
+
+func (sa SA) writeImportedConfig(fname string, stacks map[string]importedStack) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	enc := yaml.NewEncoder(f)
+	enc.SetIndent(2)
+
+	err = enc.Encode(struct {
+		Stacks map[string]importedStack `yaml:"stacks"`
+	}{stacks})
+	if err != nil {
+		return err
+	}
+
+	if err = enc.Close(); err != nil {
+		return err
+	}
+
+	sa.cli.Print(sa.cli.Color.Success(fmt.Sprintf("Config is written to %s", fname)))
+
+	return nil
+}
+
+// stacksToImport returns the stacks given by name or, if no names are given,
+// all the stacks whose names start with the prefix. Nested stacks are managed
+// by their parents and stacks in review state don't have any template
+// deployed yet, so neither of them are imported.
+func (sa SA) stacksToImport(cf cloudformationiface.CloudFormationAPI, opts ImportOptions) ([]awscf.StackInfo, error) {
+	infos := []awscf.StackInfo{}
+
+	if len(opts.StackNames) > 0 {
+		for _, name := range opts.StackNames {
+			info, err := awscf.NewStack(name, cf, nil).Info()
+			if err != nil {
+				return infos, fmt.Errorf("stack %s: %w", name, err)
+			}
+
+			logger := sa.cli.PrefixedLogger(fmt.Sprintf("[%s] ", name))
+
+			switch {
+			case info.ParentID() != "":
+				logger.Warn("Stack is skipped since it's nested. Import its root stack instead")
+			case info.InReviewState():
+				logger.Warn("Stack is skipped since it's not deployed yet (REVIEW_IN_PROGRESS)")
+			default:
+				infos = append(infos, info)
+			}
+		}
+
+		return infos, nil
+	}
+
+	all, err := awscf.ListStacks(cf)
+	if err != nil {
+		return infos, err
+	}
+
+	for _, info := range all {
+		if !strings.HasPrefix(info.Name(), opts.Prefix) {
+			continue
+		}
+
+		if info.ParentID() != "" || info.InReviewState() {
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	return infos, nil
+}
+
+func importedStackID(name, prefix string) string {
+	if id := strings.TrimPrefix(name, prefix); id != "" {
+		return id
+	}
+
+	return name
+}
+
+func importedStackDeps(id string, imports []string, exporters map[string]string) []string {
+	seen := map[string]bool{}
+	deps := []string{}
+
+	for _, imp := range imports {
+		dep, ok := exporters[imp]
+		if !ok || dep == id || seen[dep] {
+			continue
+		}
+
+		seen[dep] = true
+		deps = append(deps, dep)
+	}
+
+	sort.Strings(deps)
+
+	return deps
+}
+
+func templateExt(body string) string {
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		return ".json"
+	}
+
+	return ".yaml"
+}
@@ -0,0 +1,147 @@
+package assembly
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stas")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	opts := ImportOptions{
+		Prefix:       "myapp-",
+		TemplatesDir: filepath.Join(dir, "tpls"),
+		ConfigFile:   filepath.Join(dir, "stack-assembly.yaml"),
+	}
+
+	require.NoError(t, newImportSA().ImportConfig(importCFMock(), opts))
+
+	cfg, err := ioutil.ReadFile(opts.ConfigFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, `stacks:
+  app:
+    name: myapp-app
+    path: `+filepath.Join(opts.TemplatesDir, "app.yaml")+`
+    parameters:
+      Env: prod
+    tags:
+      Team: core
+    dependsOn:
+      - db
+  db:
+    name: myapp-db
+    path: `+filepath.Join(opts.TemplatesDir, "db.json")+`
+`, string(cfg))
+
+	body, err := ioutil.ReadFile(filepath.Join(opts.TemplatesDir, "db.json"))
+	require.NoError(t, err)
+	assert.Equal(t, dbTemplate, string(body))
+
+	err = newImportSA().ImportConfig(importCFMock(), opts)
+	assert.EqualError(t, err, "config file "+opts.ConfigFile+" already exists. Use --force to overwrite it")
+}
+
+func TestImportConfigSkipsNamedStacksThatCantBeImported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stas")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	opts := ImportOptions{
+		StackNames:   []string{"myapp-nested", "myapp-review"},
+		TemplatesDir: filepath.Join(dir, "tpls"),
+		ConfigFile:   filepath.Join(dir, "stack-assembly.yaml"),
+	}
+
+	err = newImportSA().ImportConfig(importCFMock(), opts)
+	assert.EqualError(t, err, "no stacks found to import")
+
+	opts.StackNames = []string{"myapp-review", "myapp-db"}
+
+	require.NoError(t, newImportSA().ImportConfig(importCFMock(), opts))
+
+	cfg, err := ioutil.ReadFile(opts.ConfigFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(cfg), "name: myapp-db")
+	assert.NotContains(t, string(cfg), "myapp-review")
+}
+
+const dbTemplate = `{"Outputs": {"Host": {"Value": "db", "Export": {"Name": "db-host"}}}}`
+
+func newImportSA() *SA {
+	return New(&cli.CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}})
+}
+
+func importCFMock() *importCF {
+	return &importCF{
+		stacks: []*cloudformation.Stack{{
+			StackName:   aws.String("myapp-app"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+			Parameters: []*cloudformation.Parameter{
+				{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+				{ParameterKey: aws.String("Password"), ParameterValue: aws.String(noEchoMask)},
+			},
+			Tags: []*cloudformation.Tag{{Key: aws.String("Team"), Value: aws.String("core")}},
+		}, {
+			StackName:   aws.String("myapp-db"),
+			StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+			Outputs: []*cloudformation.Output{
+				{OutputKey: aws.String("Host"), OutputValue: aws.String("db"), ExportName: aws.String("db-host")},
+			},
+		}, {
+			StackName:   aws.String("myapp-nested"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+			ParentId:    aws.String("arn:myapp-app"),
+		}, {
+			StackName:   aws.String("myapp-review"),
+			StackStatus: aws.String(cloudformation.StackStatusReviewInProgress),
+		}, {
+			StackName:   aws.String("other"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+		}},
+		templates: map[string]string{
+			"myapp-app": "Resources:\n  Svc:\n    Type: AWS::ECS::Service\n    Properties:\n      Cluster: !ImportValue db-host\n",
+			"myapp-db":  dbTemplate,
+		},
+	}
+}
+
+type importCF struct {
+	cloudformationiface.CloudFormationAPI
+
+	stacks    []*cloudformation.Stack
+	templates map[string]string
+}
+
+func (cf *importCF) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	if input.StackName == nil {
+		return &cloudformation.DescribeStacksOutput{Stacks: cf.stacks}, nil
+	}
+
+	for _, s := range cf.stacks {
+		if aws.StringValue(s.StackName) == aws.StringValue(input.StackName) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{s}}, nil
+		}
+	}
+
+	return nil, errors.New("Stack with id " + aws.StringValue(input.StackName) + " does not exist")
+}
+
+func (cf *importCF) GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(cf.templates[aws.StringValue(input.StackName)])}, nil
+}
@@ -42,17 +42,67 @@ func (sa SA) Info(stack *awscf.Stack) error {
 		return err
 	}
 
+	if sa.structured() {
+		return sa.encodeInfo(stack, info)
+	}
+
 	sa.printStackDetails(stack.Name, info)
-	sa.printResources(stack)
-	sa.printParameters(info)
-	sa.printOutputs(info)
-	sa.printEvents(stack)
+
+	if err := sa.printResources(stack); err != nil {
+		return err
+	}
+
+	if err := sa.printParameters(info); err != nil {
+		return err
+	}
+
+	if err := sa.printOutputs(info); err != nil {
+		return err
+	}
+
+	if err := sa.printEvents(stack); err != nil {
+		return err
+	}
 
 	sa.cli.Print("")
 
 	return nil
 }
 
+type stackInfoDoc struct {
+	Stack        string
+	ID           string
+	Status       string
+	StatusReason string
+	Resources    []awscf.StackResource
+	Parameters   []awscf.KeyVal
+	Outputs      []awscf.StackOutput
+	Events       []awscf.StackEvent
+}
+
+func (sa SA) encodeInfo(stack *awscf.Stack, info awscf.StackInfo) error {
+	resources, err := stack.Resources()
+	if err != nil {
+		return err
+	}
+
+	events, err := stack.Events()
+	if err != nil {
+		return err
+	}
+
+	return sa.docs.encode(stackInfoDoc{
+		Stack:        stack.Name,
+		ID:           info.ID(),
+		Status:       info.Status(),
+		StatusReason: info.StatusDescription(),
+		Resources:    resources,
+		Parameters:   info.Parameters(),
+		Outputs:      info.Outputs(),
+		Events:       events,
+	})
+}
+
 func (sa SA) InfoAll(cfg conf.Config) error {
 	ss, err := cfg.StackConfigsSortedByExecOrder()
 	if err != nil {
@@ -70,7 +120,16 @@ func (sa SA) InfoAll(cfg conf.Config) error {
 		return nil
 	}
 
-	return sa.Info(cfg.Stack())
+	if cfg.IsStackSet() {
+		return sa.infoStackSet(cfg)
+	}
+
+	stack, err := cfg.Stack()
+	if err != nil {
+		return err
+	}
+
+	return sa.Info(stack)
 }
 
 func (sa SA) printStackDetails(name string, info awscf.StackInfo) {
@@ -80,9 +139,11 @@ func (sa SA) printStackDetails(name string, info awscf.StackInfo) {
 	sa.cli.Print("")
 }
 
-func (sa SA) printResources(stack *awscf.Stack) {
+func (sa SA) printResources(stack *awscf.Stack) error {
 	resources, err := stack.Resources()
-	MustSucceed(err)
+	if err != nil {
+		return err
+	}
 
 	sa.cli.Print("==== RESOURCES ====")
 
@@ -93,11 +154,16 @@ func (sa SA) printResources(stack *awscf.Stack) {
 		fmt.Fprintln(w, strings.Join(fields, "\t"))
 	}
 
-	MustSucceed(w.Flush())
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
 	sa.cli.Print("")
+
+	return nil
 }
 
-func (sa SA) printOutputs(info awscf.StackInfo) {
+func (sa SA) printOutputs(info awscf.StackInfo) error {
 	sa.cli.Print("==== OUTPUTS ====")
 
 	w := cli.NewColWriter(sa.cli.Writer, " ")
@@ -106,28 +172,38 @@ func (sa SA) printOutputs(info awscf.StackInfo) {
 		fmt.Fprintln(w, strings.Join([]string{out.Key, out.Value, out.ExportName}, "\t"))
 	}
 
-	MustSucceed(w.Flush())
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
 	sa.cli.Print("")
+
+	return nil
 }
 
-func (sa SA) printParameters(info awscf.StackInfo) {
+func (sa SA) printParameters(info awscf.StackInfo) error {
 	sa.cli.Print("==== PARAMETERS ====")
 
 	w := cli.NewColWriter(sa.cli.Writer, " ")
 
-	info.Parameters()
-
 	for _, kv := range info.Parameters() {
 		fmt.Fprintf(w, "%s:\t%s\n", kv.Key, kv.Val)
 	}
 
-	MustSucceed(w.Flush())
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
 	sa.cli.Print("")
+
+	return nil
 }
 
-func (sa SA) printEvents(stack *awscf.Stack) {
+func (sa SA) printEvents(stack *awscf.Stack) error {
 	events, err := stack.Events()
-	MustSucceed(err)
+	if err != nil {
+		return err
+	}
 
 	w := cli.NewColWriter(sa.cli.Writer, " ")
 	sa.cli.Print("==== EVENTS ====")
@@ -141,6 +217,11 @@ func (sa SA) printEvents(stack *awscf.Stack) {
 		fmt.Fprintf(w, "[%s]\t%s\n", e.Timestamp.Format(time.RFC3339), sa.sprintEvent(e))
 	}
 
-	MustSucceed(w.Flush())
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
 	sa.cli.Print("")
+
+	return nil
 }
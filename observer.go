@@ -0,0 +1,178 @@
+package assembly
+
+import "github.com/molecule-man/stack-assembly/awscf"
+
+// Operations during which the stack is selected.
+const (
+	OperationSync   = "sync"
+	OperationDiff   = "diff"
+	OperationDelete = "delete"
+)
+
+// Stages of sync at which the hooks are executed.
+const (
+	HookStagePre        = "pre"
+	HookStagePreCreate  = "preCreate"
+	HookStagePreUpdate  = "preUpdate"
+	HookStagePostCreate = "postCreate"
+	HookStagePostUpdate = "postUpdate"
+	HookStagePost       = "post"
+)
+
+// Event is emitted by SA at every stage of sync, diff and delete of a stack.
+type Event interface {
+	// StackName returns the name of the stack the event is about.
+	StackName() string
+}
+
+// Observer is notified about the events of SA. Notify is called
+// synchronously, so the operation doesn't proceed until it returns.
+type Observer interface {
+	Notify(e Event)
+}
+
+// ObserverFunc is an adapter to use an ordinary function as Observer.
+type ObserverFunc func(e Event)
+
+// Notify calls f(e).
+func (f ObserverFunc) Notify(e Event) {
+	f(e)
+}
+
+// AddObserver registers the observer that is notified about the events after
+// the observers registered before it. The console output is the first
+// observer and is registered by New.
+func (sa *SA) AddObserver(o Observer) {
+	sa.observers = append(sa.observers, o)
+}
+
+func (sa SA) notify(e Event) {
+	for _, o := range sa.observers {
+		o.Notify(e)
+	}
+}
+
+// StackSelected is emitted when the operation on the stack starts.
+type StackSelected struct {
+	Stack     string
+	Operation string
+}
+
+// ChangeSetCreated is emitted when the change set is created and its changes
+// are known.
+type ChangeSetCreated struct {
+	Stack       string
+	ChangeSetID string
+	IsUpdate    bool
+	Changes     []awscf.Change
+}
+
+// ApprovalRequested is emitted before the user is asked to confirm the
+// execution of the change set. ChangeSetID is empty for stack sets.
+type ApprovalRequested struct {
+	Stack       string
+	ChangeSetID string
+}
+
+// ApprovalGranted is emitted when the change set is about to be executed.
+// Interactive is false if the change set is executed without asking the
+// user.
+type ApprovalGranted struct {
+	Stack       string
+	ChangeSetID string
+	Interactive bool
+}
+
+// StackEventsReceived is emitted after every poll of the events of the stack
+// while the stack operation is in progress. The events are in chronological
+// order. Events is empty if nothing happened since the previous poll.
+type StackEventsReceived struct {
+	Stack  string
+	Events awscf.StackEvents
+}
+
+// StackEventsFailed is emitted when the poll of the events of the stack
+// fails. The stack operation continues regardless.
+type StackEventsFailed struct {
+	Stack string
+	Err   error
+}
+
+// StackCompleted is emitted when the stack is synced successfully. NoChanges
+// is true if there was nothing to sync.
+type StackCompleted struct {
+	Stack     string
+	NoChanges bool
+}
+
+// StackFailed is emitted when the sync of the stack fails.
+type StackFailed struct {
+	Stack string
+	Err   error
+}
+
+// DeleteStarted is emitted when the deletion of the stack is confirmed and is
+// about to start.
+type DeleteStarted struct {
+	Stack string
+}
+
+// DeleteFinished is emitted when the deletion of the stack is complete. Err
+// is not nil if the deletion failed.
+type DeleteFinished struct {
+	Stack string
+	Err   error
+}
+
+// StackSetChangesDetected is emitted when the changes of the stack set are
+// known and before they are applied. Sections are the diffs of the
+// parameters, tags, capabilities and template of the stack set.
+type StackSetChangesDetected struct {
+	Stack    string
+	Plan     awscf.StackSetPlan
+	Sections []awscf.DiffSection
+}
+
+// StackSetOperationStarted is emitted when the operation on the stack set is
+// started. The operations of one stack set are performed one by one.
+type StackSetOperationStarted struct {
+	Stack     string
+	Operation awscf.StackSetOperation
+}
+
+// StackInstanceStatusChanged is emitted when the status of the operation on
+// one of the instances of the stack set changes.
+type StackInstanceStatusChanged struct {
+	Stack  string
+	Result awscf.StackSetOperationResult
+}
+
+// HookStarted is emitted before the hooks of the stage are executed.
+type HookStarted struct {
+	Stack string
+	Stage string
+}
+
+// HookFinished is emitted when the hooks of the stage are executed. Err is not
+// nil if one of them failed.
+type HookFinished struct {
+	Stack string
+	Stage string
+	Err   error
+}
+
+func (e StackSelected) StackName() string              { return e.Stack }
+func (e ChangeSetCreated) StackName() string           { return e.Stack }
+func (e ApprovalRequested) StackName() string          { return e.Stack }
+func (e ApprovalGranted) StackName() string            { return e.Stack }
+func (e StackEventsReceived) StackName() string        { return e.Stack }
+func (e StackEventsFailed) StackName() string          { return e.Stack }
+func (e StackCompleted) StackName() string             { return e.Stack }
+func (e StackFailed) StackName() string                { return e.Stack }
+func (e DeleteStarted) StackName() string              { return e.Stack }
+func (e DeleteFinished) StackName() string             { return e.Stack }
+func (e StackSetChangesDetected) StackName() string    { return e.Stack }
+func (e StackSetOperationStarted) StackName() string   { return e.Stack }
+func (e StackInstanceStatusChanged) StackName() string { return e.Stack }
+func (e HookStarted) StackName() string                { return e.Stack }
+func (e HookFinished) StackName() string               { return e.Stack }
@@ -0,0 +1,303 @@
+package assembly
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	awsprov "github.com/molecule-man/stack-assembly/aws"
+	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/molecule-man/stack-assembly/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserverIsNotifiedAboutSync(t *testing.T) {
+	cf := &observedCF{deployed: true}
+	sa, rec := observedSA()
+
+	approver := &fakeApprover{}
+	sa.SetApprover(approver)
+
+	_, err := sa.Sync(observedConfig(t, cf), SyncOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"StackSelected myapp-app sync",
+		"ChangeSetCreated myapp-app",
+		"ApprovalRequested myapp-app",
+		"ApprovalGranted myapp-app",
+		"StackCompleted myapp-app",
+	}, rec.events())
+
+	assert.Equal(t, []string{"myapp-app"}, approver.approved)
+	assert.True(t, cf.executed)
+	assert.Empty(t, cf.deletedChangeSets)
+}
+
+func TestObserverIsNotifiedAboutStackWithoutChanges(t *testing.T) {
+	cf := &observedCF{deployed: true, noChange: true}
+	sa, rec := observedSA()
+
+	_, err := sa.Sync(observedConfig(t, cf), SyncOptions{NonInteractive: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"StackSelected myapp-app sync",
+		"StackCompleted myapp-app no changes",
+	}, rec.events())
+
+	assert.False(t, cf.executed)
+	assert.Equal(t, []string{"cs-1"}, cf.deletedChangeSets)
+}
+
+func TestObserverIsNotifiedAboutFailedSync(t *testing.T) {
+	cf := &observedCF{deployed: true, execErr: errors.New("rollback")}
+	sa, rec := observedSA()
+
+	_, err := sa.Sync(observedConfig(t, cf), SyncOptions{NonInteractive: true})
+	require.EqualError(t, err, "rollback")
+
+	assert.Equal(t, []string{
+		"StackSelected myapp-app sync",
+		"ChangeSetCreated myapp-app",
+		"ApprovalGranted myapp-app",
+		"StackFailed myapp-app rollback",
+	}, rec.events())
+}
+
+func TestObserverIsNotifiedAboutRejectedSync(t *testing.T) {
+	cf := &observedCF{deployed: true}
+	sa, rec := observedSA()
+	sa.SetApprover(&fakeApprover{err: errors.New("rejected")})
+
+	_, err := sa.Sync(observedConfig(t, cf), SyncOptions{})
+	require.EqualError(t, err, "rejected")
+
+	assert.Equal(t, []string{
+		"StackSelected myapp-app sync",
+		"ChangeSetCreated myapp-app",
+		"ApprovalRequested myapp-app",
+		"StackFailed myapp-app rejected",
+	}, rec.events())
+
+	assert.False(t, cf.executed)
+	assert.Equal(t, []string{"cs-1"}, cf.deletedChangeSets)
+}
+
+func TestObserverIsNotifiedAboutDelete(t *testing.T) {
+	cf := &observedCF{deployed: true}
+	sa, rec := observedSA()
+	sa.SetApprover(&fakeApprover{decision: DeleteConfirmed})
+
+	require.NoError(t, sa.Delete(observedConfig(t, cf), false))
+
+	assert.Equal(t, []string{
+		"StackSelected myapp-app delete",
+		"DeleteStarted myapp-app",
+		"DeleteFinished myapp-app",
+	}, rec.events())
+
+	assert.Equal(t, []string{"myapp-app"}, cf.deletedStacks)
+}
+
+func TestSkippedDeleteIsNotStarted(t *testing.T) {
+	cf := &observedCF{deployed: true}
+	sa, rec := observedSA()
+	sa.SetApprover(&fakeApprover{decision: DeleteSkipped})
+
+	require.NoError(t, sa.Delete(observedConfig(t, cf), false))
+
+	assert.Equal(t, []string{"StackSelected myapp-app delete"}, rec.events())
+	assert.Empty(t, cf.deletedStacks)
+}
+
+func observedSA() (*SA, *eventRecorder) {
+	sa := New(&cli.CLI{Writer: &bytes.Buffer{}, Errorer: &bytes.Buffer{}})
+	rec := &eventRecorder{}
+	sa.AddObserver(ObserverFunc(rec.record))
+
+	return sa, rec
+}
+
+func observedConfig(t *testing.T, cf *observedCF) conf.Config {
+	data := `
+stacks:
+  app:
+    name: myapp-app
+    body: "Resources: {}"
+`
+
+	cfg := conf.Config{}
+	require.NoError(t, conf.NewLoader(&conf.OsFS{}, observedAwsProv{cf}).LoadConfigData([]byte(data), "yaml", &cfg))
+
+	return cfg
+}
+
+// eventRecorder records the events as short strings. The stack events are
+// skipped since the number of polls depends on timing.
+type eventRecorder struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (r *eventRecorder) record(e Event) {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", e), "assembly.")
+	line := name + " " + e.StackName()
+
+	switch e := e.(type) {
+	case StackEventsReceived, StackEventsFailed:
+		return
+	case StackSelected:
+		line += " " + e.Operation
+	case StackCompleted:
+		if e.NoChanges {
+			line += " no changes"
+		}
+	case StackFailed:
+		line += " " + e.Err.Error()
+	case DeleteFinished:
+		if e.Err != nil {
+			line += " " + e.Err.Error()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log = append(r.log, line)
+}
+
+func (r *eventRecorder) events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log
+}
+
+type fakeApprover struct {
+	err      error
+	decision DeleteDecision
+	approved []string
+}
+
+func (a *fakeApprover) ApproveSync(r SyncApproval) error {
+	a.approved = append(a.approved, r.Stack)
+	return a.err
+}
+
+func (a *fakeApprover) ApproveDelete(r DeleteApproval) (DeleteDecision, error) {
+	return a.decision, a.err
+}
+
+type observedAwsProv struct {
+	cf *observedCF
+}
+
+func (p observedAwsProv) New(awsprov.Config) (*awsprov.AWS, error) {
+	return &awsprov.AWS{CF: p.cf, AccountID: "123456789012", Region: "eu-west-1"}, nil
+}
+
+// observedCF is a fake cloudformation API that syncs and deletes the stack
+// straight away.
+type observedCF struct {
+	cloudformationiface.CloudFormationAPI
+
+	deployed bool
+	noChange bool
+	execErr  error
+
+	executed          bool
+	deletedChangeSets []string
+	deletedStacks     []string
+}
+
+func (cf *observedCF) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	if !cf.deployed {
+		return nil, errors.New("Stack with id " + aws.StringValue(input.StackName) + " does not exist")
+	}
+
+	return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{{
+		StackName:   input.StackName,
+		StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+	}}}, nil
+}
+
+func (cf *observedCF) ValidateTemplate(*cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
+	return &cloudformation.ValidateTemplateOutput{}, nil
+}
+
+func (cf *observedCF) GetTemplate(*cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String("Resources: {}")}, nil
+}
+
+func (cf *observedCF) CreateChangeSet(*cloudformation.CreateChangeSetInput) (*cloudformation.CreateChangeSetOutput, error) {
+	return &cloudformation.CreateChangeSetOutput{Id: aws.String("cs-1")}, nil
+}
+
+func (cf *observedCF) WaitUntilChangeSetCreateCompleteWithContext(
+	aws.Context,
+	*cloudformation.DescribeChangeSetInput,
+	...request.WaiterOption) error {
+	if cf.noChange {
+		return awserr.New(request.WaiterResourceNotReadyErrorCode, "failed waiting for successful resource state", nil)
+	}
+
+	return nil
+}
+
+func (cf *observedCF) DescribeChangeSet(input *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+	if cf.noChange {
+		return &cloudformation.DescribeChangeSetOutput{
+			ChangeSetId: input.ChangeSetName,
+			Status:      aws.String(cloudformation.ChangeSetStatusFailed),
+			StatusReason: aws.String("The submitted information didn't contain changes. " +
+				"Submit different information to create a change set."),
+		}, nil
+	}
+
+	return &cloudformation.DescribeChangeSetOutput{
+		ChangeSetId: input.ChangeSetName,
+		Status:      aws.String(cloudformation.ChangeSetStatusCreateComplete),
+		Changes: []*cloudformation.Change{{ResourceChange: &cloudformation.ResourceChange{
+			Action:            aws.String("Add"),
+			ResourceType:      aws.String("AWS::SQS::Queue"),
+			LogicalResourceId: aws.String("Queue"),
+		}}},
+	}, nil
+}
+
+func (cf *observedCF) ExecuteChangeSet(*cloudformation.ExecuteChangeSetInput) (*cloudformation.ExecuteChangeSetOutput, error) {
+	cf.executed = true
+	return &cloudformation.ExecuteChangeSetOutput{}, nil
+}
+
+func (cf *observedCF) WaitUntilStackUpdateCompleteWithContext(aws.Context, *cloudformation.DescribeStacksInput, ...request.WaiterOption) error {
+	return cf.execErr
+}
+
+func (cf *observedCF) DescribeStackEvents(*cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	return &cloudformation.DescribeStackEventsOutput{}, nil
+}
+
+func (cf *observedCF) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	cf.deletedChangeSets = append(cf.deletedChangeSets, aws.StringValue(input.ChangeSetName))
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
+
+func (cf *observedCF) DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	cf.deletedStacks = append(cf.deletedStacks, aws.StringValue(input.StackName))
+	return &cloudformation.DeleteStackOutput{}, nil
+}
+
+func (cf *observedCF) WaitUntilStackDeleteCompleteWithContext(aws.Context, *cloudformation.DescribeStacksInput, ...request.WaiterOption) error {
+	return nil
+}
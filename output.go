@@ -0,0 +1,93 @@
+package assembly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Supported output formats.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// SetOutputFormat switches SA to machine-readable output. In json and yaml
+// formats the documents are written into the writer of the cli while the
+// human readable messages are redirected to its error writer. Colors are
+// disabled in this mode.
+func (sa *SA) SetOutputFormat(format string) error {
+	switch format {
+	case OutputText:
+		sa.docs = nil
+		return nil
+	case OutputJSON, OutputYAML:
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+
+	sa.docs = &docEncoder{format: format, w: sa.cli.Writer}
+
+	textCli := *sa.cli
+	textCli.Writer = textCli.Errorer
+	textCli.Color.Disabled = true
+	sa.cli = &textCli
+
+	return nil
+}
+
+func (sa SA) structured() bool {
+	return sa.docs != nil
+}
+
+// docEncoder writes documents either as json lines or as stream of yaml
+// documents.
+type docEncoder struct {
+	mu     sync.Mutex
+	format string
+	w      io.Writer
+	yaml   *yaml.Encoder
+}
+
+func (e *docEncoder) encode(doc interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if e.format == OutputJSON {
+		_, err = fmt.Fprintln(e.w, string(buf))
+		return err
+	}
+
+	// json is converted to yaml node to keep the keys and their order the
+	// same in both formats
+	var node yaml.Node
+	if err = yaml.Unmarshal(buf, &node); err != nil {
+		return err
+	}
+
+	resetNodeStyle(&node)
+
+	if e.yaml == nil {
+		e.yaml = yaml.NewEncoder(e.w)
+		e.yaml.SetIndent(2)
+	}
+
+	return e.yaml.Encode(&node)
+}
+
+func resetNodeStyle(node *yaml.Node) {
+	node.Style = 0
+
+	for _, n := range node.Content {
+		resetNodeStyle(n)
+	}
+}
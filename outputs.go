@@ -0,0 +1,189 @@
+package assembly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/molecule-man/stack-assembly/conf"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Supported formats of stack outputs.
+const (
+	OutputsFormatJSON   = "json"
+	OutputsFormatYAML   = "yaml"
+	OutputsFormatShell  = "shell"
+	OutputsFormatDotenv = "dotenv"
+)
+
+// OutputsOptions controls how stack outputs are printed.
+type OutputsOptions struct {
+	Format string
+
+	// PrefixKeys enables prefixing of output keys with the ID of the stack
+	// (e.g. `staging_db_Endpoint`). It helps to avoid clashes when several
+	// stacks have outputs with the same key.
+	PrefixKeys bool
+
+	// IDPath is the path of IDs leading to the config the outputs are
+	// collected from. It's used as the beginning of the key prefix.
+	IDPath []string
+}
+
+var envKeyRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+var plainEnvValRe = regexp.MustCompile(`^[A-Za-z0-9_./:@,+=-]*$`)
+
+// WriteOutputs writes outputs of all the stacks from the config into w.
+func (sa SA) WriteOutputs(w io.Writer, cfg conf.Config, opts OutputsOptions) error {
+	outputs := map[string]string{}
+
+	if err := collectOutputs(cfg, opts.IDPath, opts.PrefixKeys, outputs); err != nil {
+		return err
+	}
+
+	return encodeOutputs(w, outputs, opts.Format)
+}
+
+// encodeOutputs writes the outputs into w in the format. Shell and dotenv
+// formats turn the keys into valid variable names, so an error is returned if
+// different keys end up being the same variable (e.g. `Db.Host` and
+// `Db-Host`).
+func encodeOutputs(w io.Writer, outputs map[string]string, format string) error {
+	keys := make([]string, 0, len(outputs))
+	for k := range outputs {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	switch format {
+	case OutputsFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(outputs)
+	case OutputsFormatYAML:
+		return yaml.NewEncoder(w).Encode(outputs)
+	case OutputsFormatShell, OutputsFormatDotenv:
+		if err := checkEnvKeys(keys); err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if format == OutputsFormatShell {
+				fmt.Fprintf(w, "export %s=%s\n", envKey(k), shellQuote(outputs[k]))
+			} else {
+				fmt.Fprintf(w, "%s=%s\n", envKey(k), dotenvQuote(outputs[k]))
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown outputs format: %s", format)
+}
+
+// prefixedOutputKey returns the key of the output prefixed with the path of IDs
+// of the stack the output belongs to.
+func prefixedOutputKey(idPath []string, key string) string {
+	if len(idPath) == 0 {
+		return key
+	}
+
+	return strings.Join(idPath, "_") + "_" + key
+}
+
+func checkEnvKeys(keys []string) error {
+	seen := make(map[string]string, len(keys))
+
+	for _, k := range keys {
+		envK := envKey(k)
+
+		if other, ok := seen[envK]; ok {
+			return fmt.Errorf("outputs %s and %s are both written as %s. Consider renaming one of them", other, k, envK)
+		}
+
+		seen[envK] = k
+	}
+
+	return nil
+}
+
+func collectOutputs(cfg conf.Config, idPath []string, prefixKeys bool, store map[string]string) error {
+	// stack sets have no outputs of their own
+	if cfg.Name != "" && !cfg.IsStackSet() {
+		stack, err := cfg.Stack()
+		if err != nil {
+			return err
+		}
+
+		exists, err := stack.Exists()
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("stack %s doesn't exist", cfg.DisplayName())
+		}
+
+		info, err := stack.Info()
+		if err != nil {
+			return err
+		}
+
+		for _, out := range info.Outputs() {
+			key := out.Key
+
+			if prefixKeys {
+				key = prefixedOutputKey(idPath, key)
+			}
+
+			if _, ok := store[key]; ok {
+				return fmt.Errorf("output %s is found in more than one stack. Consider prefixing output keys", key)
+			}
+
+			store[key] = out.Value
+		}
+	}
+
+	ids, err := cfg.StackIDsSortedByExecOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		nestedPath := append(append([]string{}, idPath...), id)
+
+		if err := collectOutputs(cfg.Stacks[id], nestedPath, prefixKeys, store); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func envKey(key string) string {
+	return envKeyRe.ReplaceAllString(key, "_")
+}
+
+func shellQuote(val string) string {
+	if val != "" && plainEnvValRe.MatchString(val) {
+		return val
+	}
+
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
+
+func dotenvQuote(val string) string {
+	if plainEnvValRe.MatchString(val) {
+		return val
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	return `"` + r.Replace(val) + `"`
+}
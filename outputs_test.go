@@ -0,0 +1,89 @@
+package assembly
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeOutputs(t *testing.T) {
+	testCases := []struct {
+		outputs        map[string]string
+		format         string
+		expectedOutput string
+	}{{
+		outputs:        map[string]string{"Db.Host": "db.local", "Port": "5432"},
+		format:         OutputsFormatShell,
+		expectedOutput: "export Db_Host=db.local\nexport Port=5432\n",
+	}, {
+		outputs:        map[string]string{"Empty": "", "Spaced": "a b", "Quoted": "it's"},
+		format:         OutputsFormatShell,
+		expectedOutput: "export Empty=''\nexport Quoted='it'\\''s'\nexport Spaced='a b'\n",
+	}, {
+		outputs:        map[string]string{"Url": "https://example.com/a?b=c"},
+		format:         OutputsFormatShell,
+		expectedOutput: "export Url='https://example.com/a?b=c'\n",
+	}, {
+		outputs:        map[string]string{"Db.Host": "db.local", "Empty": ""},
+		format:         OutputsFormatDotenv,
+		expectedOutput: "Db_Host=db.local\nEmpty=\n",
+	}, {
+		outputs:        map[string]string{"Quoted": `say "hi"`, "Multiline": "a\nb", "Backslash": `a\b`},
+		format:         OutputsFormatDotenv,
+		expectedOutput: "Backslash=\"a\\\\b\"\nMultiline=\"a\\nb\"\nQuoted=\"say \\\"hi\\\"\"\n",
+	}, {
+		outputs:        map[string]string{"Db.Host": "db.local"},
+		format:         OutputsFormatJSON,
+		expectedOutput: "{\n  \"Db.Host\": \"db.local\"\n}\n",
+	}, {
+		outputs:        map[string]string{"Db.Host": "db.local"},
+		format:         OutputsFormatYAML,
+		expectedOutput: "Db.Host: db.local\n",
+	}}
+
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+
+		require.NoError(t, encodeOutputs(out, tc.outputs, tc.format), "outputs: %+v", tc.outputs)
+		assert.Equal(t, tc.expectedOutput, out.String(), "outputs: %+v", tc.outputs)
+	}
+}
+
+func TestEncodeOutputsRejectsKeysOfTheSameVariable(t *testing.T) {
+	outputs := map[string]string{"Db.Host": "a", "Db-Host": "b"}
+
+	for _, format := range []string{OutputsFormatShell, OutputsFormatDotenv} {
+		err := encodeOutputs(&bytes.Buffer{}, outputs, format)
+		assert.EqualError(t, err, "outputs Db-Host and Db.Host are both written as Db_Host. Consider renaming one of them", format)
+	}
+
+	for _, format := range []string{OutputsFormatJSON, OutputsFormatYAML} {
+		assert.NoError(t, encodeOutputs(&bytes.Buffer{}, outputs, format), format)
+	}
+}
+
+func TestPrefixedOutputKey(t *testing.T) {
+	testCases := []struct {
+		idPath      []string
+		key         string
+		expectedKey string
+	}{{
+		idPath:      nil,
+		key:         "Endpoint",
+		expectedKey: "Endpoint",
+	}, {
+		idPath:      []string{"db"},
+		key:         "Endpoint",
+		expectedKey: "db_Endpoint",
+	}, {
+		idPath:      []string{"staging", "db"},
+		key:         "Endpoint",
+		expectedKey: "staging_db_Endpoint",
+	}}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expectedKey, prefixedOutputKey(tc.idPath, tc.key), "idPath: %+v", tc.idPath)
+	}
+}
@@ -0,0 +1,286 @@
+package assembly
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/conf"
+)
+
+type planStack struct {
+	id         string
+	name       string
+	changes    []awscf.Change
+	sections   []awscf.DiffSection
+	usePrevTpl bool
+
+	// instances are the instances of the stack set to create and delete
+	instances []string
+}
+
+type planSummary struct {
+	changed, unchanged            int
+	add, modify, remove, replaces int
+}
+
+// Plan prints deployment plan of the stacks formatted as markdown. The plan
+// is meant to be posted as a comment to a pull request. IDs of the stacks
+// that would be changed are returned the same way as Diff does it.
+func (sa SA) Plan(cfg conf.Config) ([]string, error) {
+	stacks := []planStack{}
+
+	if err := sa.collectPlan(cfg, []string{}, &stacks); err != nil {
+		return []string{}, err
+	}
+
+	plan, changed := renderPlan(stacks)
+	sa.cli.Print(plan)
+
+	return changed, nil
+}
+
+// renderPlan formats the plan of the stacks as markdown and returns it along
+// with the IDs of the stacks that would be changed.
+func renderPlan(stacks []planStack) (string, []string) {
+	changed := []string{}
+	summary := planSummary{}
+	b := &strings.Builder{}
+
+	fmt.Fprintln(b, "## Deployment plan")
+
+	for _, s := range stacks {
+		if len(s.changes) == 0 && len(s.sections) == 0 && len(s.instances) == 0 {
+			summary.unchanged++
+			continue
+		}
+
+		summary.changed++
+		changed = append(changed, s.id)
+
+		fmt.Fprintf(b, "\n### `%s`\n\n", s.name)
+
+		if len(s.changes) > 0 {
+			writeMarkdownChanges(b, s.changes, &summary)
+		}
+
+		for _, i := range s.instances {
+			fmt.Fprintf(b, "- %s\n", i)
+		}
+
+		if s.usePrevTpl {
+			fmt.Fprintln(b, "\nTemplate is unchanged (usePreviousTemplate).")
+		}
+
+		for _, section := range s.sections {
+			diff := strings.TrimRight(section.Diff, "\n")
+			fence := markdownFence(diff)
+
+			fmt.Fprintf(b, "\n<details>\n<summary>%s diff</summary>\n\n", section.Name)
+			fmt.Fprintf(b, "%sdiff\n%s\n%s\n\n</details>\n", fence, diff, fence)
+		}
+	}
+
+	fmt.Fprintf(b, "\n**Summary:** %d stack(s) to change, %d unchanged. ", summary.changed, summary.unchanged)
+	fmt.Fprintf(b, "Resources: %d to add, %d to modify (%d with replacement), %d to remove.",
+		summary.add, summary.modify, summary.replaces, summary.remove)
+
+	return b.String(), changed
+}
+
+func (sa SA) collectPlan(cfg conf.Config, idPath []string, stacks *[]planStack) error {
+	if cfg.HasTemplate() {
+		planChanges := planStackChanges
+		if cfg.IsStackSet() {
+			planChanges = planStackSetChanges
+		}
+
+		s, err := planChanges(cfg, sa.unifiedDiff)
+		if err != nil {
+			return err
+		}
+
+		s.id = strings.Join(idPath, " ")
+		if s.id == "" {
+			s.id = cfg.Name
+		}
+
+		*stacks = append(*stacks, s)
+	}
+
+	ids, err := cfg.StackIDsSortedByExecOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		nestedPath := append(append([]string{}, idPath...), id)
+
+		if err := sa.collectPlan(cfg.Stacks[id], nestedPath, stacks); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func planStackChanges(cfg conf.Config, unified bool) (_ planStack, err error) {
+	s := planStack{name: cfg.DisplayName()}
+	cs, err := cfg.ChangeSet()
+	if err != nil {
+		return s, err
+	}
+
+	s.usePrevTpl = cs.UsesPreviousTemplate()
+
+	defer func() {
+		if closeErr := cs.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	s.sections, err = awscf.ChSetDiff{Unified: unified}.Sections(cs)
+	if err != nil {
+		return s, err
+	}
+
+	chSet, err := cs.Register()
+	if chSet != nil {
+		defer func() {
+			if delErr := chSet.Delete(); delErr != nil && err == nil {
+				err = delErr
+			}
+		}()
+	}
+
+	if errors.Is(err, awscf.ErrNoChange) {
+		return s, nil
+	}
+
+	if err != nil {
+		return s, err
+	}
+
+	s.changes = chSet.Changes
+
+	nestedSections, err := awscf.ChSetDiff{Unified: unified}.NestedSections(chSet)
+	s.sections = append(s.sections, nestedSections...)
+
+	return s, err
+}
+
+func planStackSetChanges(cfg conf.Config, unified bool) (_ planStack, err error) {
+	s := planStack{name: cfg.DisplayName()}
+
+	ss, err := cfg.StackSetDeployment()
+	if err != nil {
+		return s, err
+	}
+
+	defer func() {
+		if closeErr := ss.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	plan, err := ss.Plan()
+	if err != nil {
+		return s, err
+	}
+
+	for _, b := range plan.Create {
+		s.instances = append(s.instances, "Instances to create: "+markdownCell(b.String()))
+	}
+
+	for _, b := range plan.Delete {
+		s.instances = append(s.instances, "Instances to delete: "+markdownCell(b.String()))
+	}
+
+	s.sections, err = awscf.ChSetDiff{Unified: unified}.StackSetSections(plan)
+
+	return s, err
+}
+
+func writeMarkdownChanges(b *strings.Builder, changes []awscf.Change, summary *planSummary) {
+	fmt.Fprintln(b, "| Action | Resource Type | Resource ID | Replacement needed |")
+	fmt.Fprintln(b, "|--------|---------------|-------------|--------------------|")
+
+	awscf.WalkChanges(changes, func(c awscf.Change, depth int) {
+		switch strings.ToLower(c.Action) {
+		case "add":
+			summary.add++
+		case "remove":
+			summary.remove++
+		default:
+			summary.modify++
+		}
+
+		repl := "No"
+
+		switch {
+		case c.ReplacementNeeded:
+			repl = "**Yes**"
+			summary.replaces++
+		case c.Replacement == cloudformation.ReplacementConditional:
+			repl = "Conditional"
+		}
+
+		fmt.Fprintf(b, "| %s | %s | %s | %s |\n", markdownCell(c.Action), markdownCell(c.ResourceType),
+			markdownCell(nestedResourceID(c.LogicalResourceID, depth)), repl)
+	})
+
+	writeMarkdownChangeDetails(b, changes)
+}
+
+func writeMarkdownChangeDetails(b *strings.Builder, changes []awscf.Change) {
+	rows := []string{}
+
+	awscf.WalkChanges(changes, func(c awscf.Change, depth int) {
+		for _, d := range c.Details {
+			rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s |",
+				markdownCell(nestedResourceID(c.LogicalResourceID, depth)), markdownCell(d.Target()),
+				markdownCell(d.RequiresRecreation), markdownCell(d.Cause())))
+		}
+	})
+
+	if len(rows) == 0 {
+		return
+	}
+
+	fmt.Fprint(b, "\n<details>\n<summary>Changed properties</summary>\n\n")
+	fmt.Fprintln(b, "| Resource ID | Property | Requires recreation | Caused by |")
+	fmt.Fprintln(b, "|-------------|----------|---------------------|-----------|")
+	fmt.Fprintln(b, strings.Join(rows, "\n"))
+	fmt.Fprint(b, "\n</details>\n")
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// markdownFence returns the code fence that is longer than any run of
+// backticks in the content, so that the content can't close it (templates may
+// contain markdown themselves, e.g. in descriptions).
+func markdownFence(content string) string {
+	longest, run := 0, 0
+
+	for _, r := range content {
+		if r != '`' {
+			run = 0
+			continue
+		}
+
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+
+	if longest < 3 {
+		return "```"
+	}
+
+	return strings.Repeat("`", longest+1)
+}
@@ -0,0 +1,100 @@
+package assembly
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestRenderPlan(t *testing.T) {
+	stacks := []planStack{{
+		id:   "staging db",
+		name: "staging-db",
+		changes: []awscf.Change{{
+			Action:            "Modify",
+			ResourceType:      "AWS::RDS::DBInstance",
+			LogicalResourceID: "Db",
+			ReplacementNeeded: true,
+			Replacement:       "True",
+			Details: []awscf.ChangeDetail{{
+				Attribute:          "Properties",
+				Name:               "Engine",
+				RequiresRecreation: "Always",
+				ChangeSource:       "DirectModification",
+			}},
+		}, {
+			Action:            "Modify",
+			ResourceType:      "AWS::CloudFormation::Stack",
+			LogicalResourceID: "Nested",
+			Replacement:       "Conditional",
+			Nested: []awscf.Change{{
+				Action:            "Add",
+				ResourceType:      "AWS::SQS::Queue",
+				LogicalResourceID: "Queue",
+			}},
+		}, {
+			Action:            "Remove",
+			ResourceType:      "Custom::Pipe|Resource",
+			LogicalResourceID: "Legacy",
+		}},
+		sections: []awscf.DiffSection{{
+			Name: "Template",
+			Diff: "-Description: old\n+Description: uses ```yaml``` blocks\n",
+		}, {
+			Name: "Parameters",
+			Diff: "-Engine: mysql\n+Engine: postgres\n",
+		}},
+	}, {
+		id:   "staging cache",
+		name: "staging-cache",
+	}, {
+		id:         "staging app",
+		name:       "staging-app",
+		usePrevTpl: true,
+		sections: []awscf.DiffSection{{
+			Name: "Tags",
+			Diff: "+Team: core\n",
+		}},
+	}, {
+		id:        "workers",
+		name:      "workers",
+		instances: []string{"Instances to create: targets: 111, regions: eu-west-1"},
+	}}
+
+	plan, changed := renderPlan(stacks)
+
+	assert.Equal(t, []string{"staging db", "staging app", "workers"}, changed)
+
+	golden := filepath.Join("testdata", "plan.md")
+
+	if *update {
+		require.NoError(t, ioutil.WriteFile(golden, []byte(plan), 0644))
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), plan)
+}
+
+func TestMarkdownFenceIsLongerThanBackticksOfContent(t *testing.T) {
+	testCases := []struct {
+		content       string
+		expectedFence string
+	}{
+		{content: "no backticks", expectedFence: "```"},
+		{content: "inline `code`", expectedFence: "```"},
+		{content: "```yaml\nkey: val\n```", expectedFence: "````"},
+		{content: "`````", expectedFence: "``````"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expectedFence, markdownFence(tc.content), "content: %s", tc.content)
+	}
+}
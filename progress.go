@@ -0,0 +1,193 @@
+package assembly
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+)
+
+// progressMaxRows limits the number of resource rows of the progress view.
+// The rows that don't fit into the terminal can't be redrawn, so the
+// resources that are complete are collapsed into the summary line first.
+const progressMaxRows = 30
+
+const progressReasonWidth = 100
+
+// SetLiveProgress enables live progress view of the stack operations. Instead
+// of printing stack events line by line, the view with the current status of
+// every resource is redrawn in place. It's meant to be enabled only when the
+// output is a terminal.
+func (sa *SA) SetLiveProgress(enabled bool) {
+	sa.liveProgress = enabled
+}
+
+type resourceProgress struct {
+	id      string
+	typ     string
+	status  string
+	started time.Time
+	updated time.Time
+}
+
+func (r resourceProgress) elapsed(now time.Time) time.Duration {
+	if strings.HasSuffix(r.status, "IN_PROGRESS") {
+		return now.Sub(r.started)
+	}
+
+	return r.updated.Sub(r.started)
+}
+
+// progressView keeps the current status of the resources of the stack that
+// is being synced and renders it as live view.
+type progressView struct {
+	sa    SA
+	stack string
+	view  *cli.LiveView
+
+	resources   map[string]*resourceProgress
+	lastFailure string
+	warning     string
+}
+
+func (sa SA) newProgressView(stack string) *progressView {
+	return &progressView{
+		sa:        sa,
+		stack:     stack,
+		view:      cli.NewLiveView(sa.cli.Writer),
+		resources: map[string]*resourceProgress{},
+	}
+}
+
+func (p *progressView) update(events awscf.StackEvents) {
+	for _, e := range events {
+		r, ok := p.resources[e.LogicalResourceID]
+		if !ok || !strings.HasSuffix(r.status, "IN_PROGRESS") {
+			r = &resourceProgress{id: e.LogicalResourceID, typ: e.ResourceType, started: e.Timestamp}
+			p.resources[e.LogicalResourceID] = r
+		}
+
+		r.status = e.Status
+		r.updated = e.Timestamp
+
+		if strings.HasSuffix(e.Status, "FAILED") && e.StatusReason != "" {
+			p.lastFailure = fmt.Sprintf("%s: %s", e.LogicalResourceID, e.StatusReason)
+		}
+	}
+}
+
+func (p *progressView) render(now time.Time) error {
+	complete, inProgress, failed := 0, 0, 0
+	rows := []*resourceProgress{}
+
+	var stackRow *resourceProgress
+
+	for _, r := range p.resources {
+		if r.id == p.stack {
+			stackRow = r
+			continue
+		}
+
+		switch {
+		case isFailedStatus(r.status):
+			failed++
+		case strings.HasSuffix(r.status, "IN_PROGRESS"):
+			inProgress++
+		default:
+			complete++
+		}
+
+		rows = append(rows, r)
+	}
+
+	// failed and in progress resources go first, the recently updated ones
+	// are preferred among the rest
+	sort.Slice(rows, func(i, j int) bool {
+		if pi, pj := progressPriority(rows[i].status), progressPriority(rows[j].status); pi != pj {
+			return pi < pj
+		}
+
+		if !rows[i].updated.Equal(rows[j].updated) {
+			return rows[i].updated.After(rows[j].updated)
+		}
+
+		return rows[i].id < rows[j].id
+	})
+
+	hidden := 0
+	if len(rows) > progressMaxRows {
+		hidden = len(rows) - progressMaxRows
+		rows = rows[:progressMaxRows]
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+
+	lines := []string{}
+
+	header := fmt.Sprintf("STACK: %s", p.stack)
+	if stackRow != nil {
+		header += fmt.Sprintf(" %s (%s)", p.sa.colorizedStatus(stackRow.status), formatElapsed(stackRow.elapsed(now)))
+	}
+
+	lines = append(lines, header)
+
+	b := &strings.Builder{}
+	w := cli.NewColWriter(b, " ")
+
+	for _, r := range rows {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", r.id, r.typ, p.sa.colorizedStatus(r.status), formatElapsed(r.elapsed(now)))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if b.Len() > 0 {
+		lines = append(lines, strings.TrimRight(b.String(), "\n"))
+	}
+
+	if hidden > 0 {
+		lines = append(lines, fmt.Sprintf("  ... %d more resource(s)", hidden))
+	}
+
+	lines = append(lines, fmt.Sprintf("Complete: %s  In progress: %s  Failed: %s",
+		p.sa.cli.Color.Success(fmt.Sprint(complete)),
+		p.sa.cli.Color.Neutral(fmt.Sprint(inProgress)),
+		p.sa.cli.Color.Fail(fmt.Sprint(failed))))
+
+	if p.lastFailure != "" {
+		lines = append(lines, p.sa.cli.Color.Fail("Last failure: ")+cli.WordWrap(progressReasonWidth, p.lastFailure))
+	}
+
+	if p.warning != "" {
+		lines = append(lines, p.sa.cli.Color.Warn(cli.WordWrap(progressReasonWidth, p.warning)))
+	}
+
+	return p.view.Render(lines...)
+}
+
+func isFailedStatus(status string) bool {
+	return strings.HasSuffix(status, "FAILED") || strings.Contains(status, "ROLLBACK")
+}
+
+func progressPriority(status string) int {
+	switch {
+	case isFailedStatus(status):
+		return 0
+	case strings.HasSuffix(status, "IN_PROGRESS"):
+		return 1
+	}
+
+	return 2
+}
+
+func formatElapsed(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	return d.Truncate(time.Second).String()
+}
@@ -0,0 +1,100 @@
+package assembly
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressViewTracksResources(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	p, _ := newTestProgressView()
+
+	p.update(awscf.StackEvents{
+		progressEvent(start, "Queue", "CREATE_IN_PROGRESS", ""),
+		progressEvent(start.Add(5*time.Second), "Queue", "CREATE_COMPLETE", ""),
+		progressEvent(start.Add(6*time.Second), "Db", "CREATE_IN_PROGRESS", ""),
+		progressEvent(start.Add(9*time.Second), "Db", "CREATE_FAILED", "invalid instance class"),
+	})
+
+	require.Len(t, p.resources, 2)
+	assert.Equal(t, 5*time.Second, p.resources["Queue"].elapsed(start.Add(time.Minute)))
+	assert.Equal(t, "CREATE_FAILED", p.resources["Db"].status)
+	assert.Equal(t, "Db: invalid instance class", p.lastFailure)
+
+	// the new operation on the resource is timed from its own start
+	p.update(awscf.StackEvents{
+		progressEvent(start.Add(20*time.Second), "Queue", "DELETE_IN_PROGRESS", ""),
+	})
+
+	assert.Equal(t, 10*time.Second, p.resources["Queue"].elapsed(start.Add(30*time.Second)))
+}
+
+func TestProgressViewRendersResources(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	p, out := newTestProgressView()
+
+	p.update(awscf.StackEvents{
+		progressEvent(start, "mystack", "UPDATE_IN_PROGRESS", ""),
+		progressEvent(start, "Queue", "CREATE_IN_PROGRESS", ""),
+		progressEvent(start.Add(5*time.Second), "Queue", "CREATE_COMPLETE", ""),
+		progressEvent(start.Add(6*time.Second), "Db", "UPDATE_IN_PROGRESS", ""),
+		progressEvent(start.Add(7*time.Second), "Topic", "CREATE_IN_PROGRESS", ""),
+		progressEvent(start.Add(9*time.Second), "Topic", "CREATE_FAILED", "access denied"),
+	})
+
+	require.NoError(t, p.render(start.Add(10*time.Second)))
+
+	assert.Equal(t, "\x1b[J"+`STACK: mystack UPDATE_IN_PROGRESS (10s)
+  Db    AWS::Test::Resource UPDATE_IN_PROGRESS 4s
+  Queue AWS::Test::Resource CREATE_COMPLETE    5s
+  Topic AWS::Test::Resource CREATE_FAILED      2s
+Complete: 1  In progress: 1  Failed: 1
+Last failure: Topic: access denied
+`, out.String())
+}
+
+func TestProgressViewCollapsesCompleteResources(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	p, out := newTestProgressView()
+
+	events := awscf.StackEvents{progressEvent(start, "Failed", "CREATE_FAILED", "")}
+	for i := 0; i < progressMaxRows+2; i++ {
+		events = append(events, progressEvent(start, fmt.Sprintf("Res%02d", i), "CREATE_COMPLETE", ""))
+	}
+
+	p.update(events)
+	require.NoError(t, p.render(start))
+
+	assert.Contains(t, out.String(), "  Failed ")
+	assert.Contains(t, out.String(), "  ... 3 more resource(s)\n")
+	assert.Contains(t, out.String(), "Complete: 32  In progress: 0  Failed: 1\n")
+}
+
+func newTestProgressView() (*progressView, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	sa := New(&cli.CLI{Writer: out, Errorer: &bytes.Buffer{}, Color: cli.Color{Disabled: true}})
+
+	return sa.newProgressView("mystack"), out
+}
+
+func progressEvent(ts time.Time, id, status, reason string) awscf.StackEvent {
+	typ := "AWS::Test::Resource"
+	if id == "mystack" {
+		typ = "AWS::CloudFormation::Stack"
+	}
+
+	return awscf.StackEvent{
+		LogicalResourceID: id,
+		ResourceType:      typ,
+		Status:            status,
+		StatusReason:      reason,
+		Timestamp:         ts,
+	}
+}
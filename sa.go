@@ -3,9 +3,27 @@ package assembly
 import "github.com/molecule-man/stack-assembly/cli"
 
 type SA struct {
-	cli *cli.CLI
+	cli  *cli.CLI
+	docs *docEncoder
+
+	unifiedDiff  bool
+	liveProgress bool
+
+	observers []Observer
+	approver  Approver
 }
 
 func New(c *cli.CLI) *SA {
-	return &SA{c}
+	sa := &SA{cli: c}
+	sa.observers = []Observer{newConsoleObserver(sa)}
+	sa.approver = consoleApprover{sa}
+
+	return sa
+}
+
+// SetLogging sets the verbosity of the messages printed to the console and
+// the log file the messages are recorded to. log can be nil.
+func (sa *SA) SetLogging(level cli.Level, log *cli.JSONLog) {
+	sa.cli.Level = level
+	sa.cli.JSONLog = log
 }
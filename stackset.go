@@ -0,0 +1,221 @@
+package assembly
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/cli"
+	"github.com/molecule-man/stack-assembly/conf"
+)
+
+// execStackSet syncs the stack set. It returns false if the stack set and
+// its instances are already up to date.
+func (sa SA) execStackSet(ctx context.Context, cfg conf.Config, logger *cli.Logger, opts SyncOptions) (bool, error) {
+	name := cfg.DisplayName()
+
+	ss, err := cfg.StackSetDeployment()
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if closeErr := ss.Close(); closeErr != nil {
+			logger.Warnf("Error while cleaning up: %s", closeErr.Error())
+		}
+	}()
+
+	plan, err := ss.Plan()
+	if err != nil || !plan.HasChanges() {
+		return false, err
+	}
+
+	sections, err := sa.differ().StackSetSections(plan)
+	if err != nil {
+		return false, err
+	}
+
+	sa.notify(StackSetChangesDetected{Stack: name, Plan: plan, Sections: sections})
+
+	if !opts.NonInteractive {
+		sa.notify(ApprovalRequested{Stack: name})
+
+		err = untilCanceled(ctx, func() error {
+			return sa.approver.ApproveSync(SyncApproval{Stack: name, StackSetPlan: &plan})
+		})
+		if err != nil {
+			return true, err
+		}
+	}
+
+	sa.notify(ApprovalGranted{Stack: name, Interactive: !opts.NonInteractive})
+
+	change := &conf.HookChange{IsUpdate: plan.Exists}
+
+	if plan.Exists {
+		err = sa.execHooks(ctx, HookStagePreUpdate, cfg.Hooks.PreUpdate, cfg, change, nil)
+	} else {
+		err = sa.execHooks(ctx, HookStagePreCreate, cfg.Hooks.PreCreate, cfg, change, nil)
+	}
+
+	if err != nil {
+		return true, err
+	}
+
+	err = untilCanceled(ctx, func() error {
+		return ss.Apply(plan, awscf.StackSetListener{
+			OperationStarted: func(op awscf.StackSetOperation) {
+				sa.notify(StackSetOperationStarted{Stack: name, Operation: op})
+			},
+			ResultChanged: func(r awscf.StackSetOperationResult) {
+				sa.notify(StackInstanceStatusChanged{Stack: name, Result: r})
+			},
+		})
+	})
+	if err != nil {
+		return true, err
+	}
+
+	if plan.Exists {
+		return true, sa.execHooks(ctx, HookStagePostUpdate, cfg.Hooks.PostUpdate, cfg, change, nil)
+	}
+
+	return true, sa.execHooks(ctx, HookStagePostCreate, cfg.Hooks.PostCreate, cfg, change, nil)
+}
+
+// showStackSetChanges prints the diff of the stack set and the instances that
+// are going to be created and deleted.
+func (sa SA) showStackSetChanges(plan awscf.StackSetPlan, sections []awscf.DiffSection, logger *cli.Logger) {
+	switch {
+	case !plan.Exists:
+		logger.Info("Stack set is going to be created")
+	case plan.Update:
+		logger.Info("Stack set is going to be updated")
+	}
+
+	if diff := sa.differ().Render(sections); diff != "" {
+		sa.cli.Print(diff)
+	}
+
+	for _, b := range plan.Create {
+		logger.Print(sa.cli.Color.Success("Instances to create: " + b.String()))
+	}
+
+	for _, b := range plan.Delete {
+		logger.Print(sa.cli.Color.Fail("Instances to delete: " + b.String()))
+	}
+}
+
+func (sa SA) sprintInstanceResult(r awscf.StackSetOperationResult) string {
+	status := sa.cli.Color.Neutral(r.Status)
+
+	switch r.Status {
+	case cloudformation.StackSetOperationResultStatusSucceeded:
+		status = sa.cli.Color.Success(r.Status)
+	case cloudformation.StackSetOperationResultStatusFailed, cloudformation.StackSetOperationResultStatusCancelled:
+		status = sa.cli.Color.Fail(r.Status)
+	}
+
+	fields := []string{r.Account, r.Region, status}
+	if r.StatusReason != "" {
+		fields = append(fields, r.StatusReason)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// diffStackSet shows the changes of the stack set. It returns true if sync
+// would change the stack set or its instances.
+func (sa SA) diffStackSet(cfg conf.Config, quiet bool) (bool, error) {
+	sa.notify(StackSelected{Stack: cfg.DisplayName(), Operation: OperationDiff})
+
+	ss, err := cfg.StackSetDeployment()
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if closeErr := ss.Close(); closeErr != nil {
+			sa.cli.Warnf("Error while cleaning up: %s", closeErr.Error())
+		}
+	}()
+
+	plan, err := ss.Plan()
+	if err != nil {
+		return false, err
+	}
+
+	sections, err := sa.differ().StackSetSections(plan)
+	if err != nil || quiet || !plan.HasChanges() {
+		return plan.HasChanges(), err
+	}
+
+	if sa.structured() {
+		return true, sa.docs.encode(struct {
+			StackSet string
+			Exists   bool
+			Sections []awscf.DiffSection
+			Create   []awscf.InstanceBatch `json:",omitempty"`
+			Delete   []awscf.InstanceBatch `json:",omitempty"`
+		}{cfg.DisplayName(), plan.Exists, sections, plan.Create, plan.Delete})
+	}
+
+	sa.showStackSetChanges(plan, sections, sa.cli.PrefixedLogger(fmt.Sprintf("[%s] ", cfg.DisplayName())))
+
+	return true, nil
+}
+
+// infoStackSet prints the instances of the stack set.
+func (sa SA) infoStackSet(cfg conf.Config) error {
+	ss, err := cfg.StackSetDeployment()
+	if err != nil {
+		return err
+	}
+
+	instances, err := ss.Instances()
+	if err != nil {
+		return err
+	}
+
+	if sa.structured() {
+		return sa.docs.encode(struct {
+			StackSet  string
+			Instances []awscf.StackInstance
+		}{cfg.DisplayName(), instances})
+	}
+
+	sa.cli.Print("######################################")
+	sa.cli.Print(fmt.Sprintf("STACK SET:\t%s", cfg.DisplayName()))
+	sa.cli.Print("")
+	sa.cli.Print("==== INSTANCES ====")
+
+	w := cli.NewColWriter(sa.cli.Writer, " ")
+
+	for _, i := range instances {
+		fields := []string{i.Account, i.Region, sa.colorizedInstanceStatus(i.Status), i.StatusReason}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	sa.cli.Print("")
+
+	return nil
+}
+
+func (sa SA) colorizedInstanceStatus(status string) string {
+	switch status {
+	case cloudformation.StackInstanceStatusCurrent:
+		return sa.cli.Color.Success(status)
+	case cloudformation.StackInstanceStatusOutdated:
+		return sa.cli.Color.Warn(status)
+	case cloudformation.StackInstanceStatusInoperable:
+		return sa.cli.Color.Fail(status)
+	}
+
+	return status
+}
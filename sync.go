@@ -1,45 +1,81 @@
 package assembly
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/molecule-man/stack-assembly/awscf"
 	"github.com/molecule-man/stack-assembly/cli"
 	"github.com/molecule-man/stack-assembly/conf"
 )
 
-func (sa SA) Sync(cfg conf.Config, nonInteractive bool) ([]*awscf.Stack, error) {
-	return sa.syncRecursively(cfg, cfg, nonInteractive)
+// ErrInterrupted is returned by Sync when the program is interrupted before
+// the change set is executed.
+var ErrInterrupted = errors.New("interrupted")
+
+// SyncOptions controls how the stacks are synced.
+type SyncOptions struct {
+	// NonInteractive disables all the prompts. The change sets are executed
+	// without confirmation and missing parameters result in an error.
+	NonInteractive bool
+
+	// HandleInterrupts makes sync stop when the program receives SIGINT or
+	// SIGTERM. The change set that is not executed yet is deleted and Sync
+	// returns ErrInterrupted. The stack that is already being changed is left
+	// to cloudformation.
+	HandleInterrupts bool
+
+	// OnStackEvent is called for every event of the stack that is being
+	// synced. OnStackEvent and OnResult can be called concurrently when the
+	// targets of the stack are synced in parallel.
+	OnStackEvent func(stack string, e awscf.StackEvent)
+
+	// OnResult is called when the sync of the stack is finished. err is nil
+	// if the sync succeeded.
+	OnResult func(stack string, err error)
 }
 
-func (sa SA) syncRecursively(stackCfg conf.Config, root conf.Config, nonInteractive bool) ([]*awscf.Stack, error) {
+// Sync creates or updates the stacks of the config and of its nested configs.
+func (sa SA) Sync(cfg conf.Config, opts SyncOptions) ([]*awscf.Stack, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if opts.HandleInterrupts {
+		stopInterruptHandler := cancelOnInterrupt(cancel, sa.cli.PrefixedLogger(""))
+		defer stopInterruptHandler()
+	}
+
+	return sa.syncRecursively(ctx, cfg, opts)
+}
+
+func (sa SA) syncRecursively(ctx context.Context, stackCfg conf.Config, opts SyncOptions) ([]*awscf.Stack, error) {
 	syncedStacks := []*awscf.Stack{}
 
-	MustSucceed(stackCfg.Hooks.Pre.Exec())
+	if err := sa.execHooks(ctx, HookStagePre, stackCfg.Hooks.Pre, stackCfg, nil, nil); err != nil {
+		return syncedStacks, err
+	}
 
-	if stackCfg.Body != "" || stackCfg.UsePreviousTemplate {
-		logger := sa.cli.PrefixedLogger(fmt.Sprintf("[%s] ", stackCfg.Name))
+	var stack *awscf.Stack
 
-		logger.Info("Synchronizing template")
+	if stackCfg.HasTemplate() {
+		var err error
 
-		stack, err := sa.exec(stackCfg, logger, nonInteractive)
+		stack, err = sa.syncStack(ctx, stackCfg, opts)
 		if err != nil {
 			return syncedStacks, err
 		}
 
-		for _, r := range stackCfg.Blocked {
-			logger.Infof("Blocking resource %s", r)
-
-			err = stack.BlockResource(r)
-			if err != nil {
-				return syncedStacks, err
-			}
+		if stack != nil {
+			syncedStacks = []*awscf.Stack{stack}
 		}
-
-		syncedStacks = []*awscf.Stack{stack}
 	}
 
 	nestedStacks, err := stackCfg.StackConfigsSortedByExecOrder()
@@ -47,8 +83,19 @@ func (sa SA) syncRecursively(stackCfg conf.Config, root conf.Config, nonInteract
 		return syncedStacks, err
 	}
 
+	if stackCfg.FanOut() {
+		ss, err := sa.syncTargets(ctx, nestedStacks, stackCfg.Concurrency, opts)
+		syncedStacks = append(syncedStacks, ss...)
+
+		if err != nil {
+			return syncedStacks, err
+		}
+
+		return syncedStacks, sa.execHooks(ctx, HookStagePost, stackCfg.Hooks.Post, stackCfg, nil, stack)
+	}
+
 	for _, nestedStack := range nestedStacks {
-		ss, err := sa.syncRecursively(nestedStack, root, nonInteractive)
+		ss, err := sa.syncRecursively(ctx, nestedStack, opts)
 		if err != nil {
 			return syncedStacks, err
 		}
@@ -56,88 +103,256 @@ func (sa SA) syncRecursively(stackCfg conf.Config, root conf.Config, nonInteract
 		syncedStacks = append(syncedStacks, ss...)
 	}
 
-	return syncedStacks, stackCfg.Hooks.Post.Exec()
+	return syncedStacks, sa.execHooks(ctx, HookStagePost, stackCfg.Hooks.Post, stackCfg, nil, stack)
 }
 
-func (sa SA) exec(stackCfg conf.Config, logger *cli.Logger, nonInteractive bool) (*awscf.Stack, error) {
-	cs := stackCfg.ChangeSet()
+// syncStack syncs the stack (or the stack set) of the config. No stack is
+// returned for the stack set.
+func (sa SA) syncStack(ctx context.Context, stackCfg conf.Config, opts SyncOptions) (*awscf.Stack, error) {
+	name := stackCfg.DisplayName()
+	logger := sa.cli.PrefixedLogger(fmt.Sprintf("[%s] ", name))
 
-	chSet, err := sa.register(cs, logger)
-	if errors.Is(err, awscf.ErrNoChange) {
-		logger.Info("No changes to be synchronized")
-		return cs.Stack(), nil
+	sa.notify(StackSelected{Stack: name, Operation: OperationSync})
+
+	if stackCfg.IsStackSet() {
+		changed, err := sa.execStackSet(ctx, stackCfg, logger, opts)
+		sa.notifyResult(name, changed, err)
+
+		if opts.OnResult != nil {
+			opts.OnResult(name, err)
+		}
+
+		return nil, err
+	}
+
+	stack, changed, err := sa.exec(ctx, stackCfg, logger, opts)
+	sa.notifyResult(name, changed, err)
+
+	if opts.OnResult != nil {
+		opts.OnResult(name, err)
+	}
+
+	if err != nil {
+		return stack, err
+	}
+
+	for _, r := range stackCfg.Blocked {
+		logger.Infof("Blocking resource %s", r)
+
+		if err = stack.BlockResource(r); err != nil {
+			return stack, err
+		}
+	}
+
+	return stack, nil
+}
+
+// eventsPollInterval is how often the events of the stack are requested while
+// the stack is being synced.
+const eventsPollInterval = 2 * time.Second
+
+// notifyResult notifies the observers about the outcome of the sync of the
+// stack.
+func (sa SA) notifyResult(stackName string, changed bool, err error) {
+	if err != nil {
+		sa.notify(StackFailed{Stack: stackName, Err: err})
+		return
 	}
 
+	sa.notify(StackCompleted{Stack: stackName, NoChanges: !changed})
+}
+
+// exec syncs the stack. It returns false if the stack is already up to date.
+// The change set is deleted unless it's executed. That includes the failed
+// change set cloudformation keeps when there is nothing to change.
+func (sa SA) exec(ctx context.Context, stackCfg conf.Config, logger *cli.Logger, opts SyncOptions) (*awscf.Stack, bool, error) {
+	cs, err := stackCfg.ChangeSet()
 	if err != nil {
-		return cs.Stack(), err
+		return nil, false, err
 	}
 
+	var chSet *awscf.ChangeSetHandle
+
+	executed := false
+
 	defer func() {
+		if !executed {
+			sa.deleteChangeSet(chSet, logger)
+		}
+
 		if closeErr := cs.Close(); closeErr != nil {
 			logger.Warnf("Error while cleaning up: %s", closeErr.Error())
 		}
 	}()
 
-	logger.Infof("Change set is created: %s", chSet.ID)
+	chSet, err = sa.register(ctx, cs, stackCfg.DisplayName(), logger, opts)
+	if errors.Is(err, awscf.ErrNoChange) {
+		return cs.Stack(), false, nil
+	}
+
+	if err == nil && ctx.Err() != nil {
+		err = ErrInterrupted
+	}
+
+	if err != nil {
+		return cs.Stack(), false, err
+	}
 
-	sa.showChanges(chSet.Changes)
+	sa.notify(ChangeSetCreated{Stack: stackCfg.DisplayName(), ChangeSetID: chSet.ID, IsUpdate: chSet.IsUpdate, Changes: chSet.Changes})
 
-	if !nonInteractive {
-		err = sa.letUserChooseNextAction(cs)
+	change := &conf.HookChange{ChangeSetID: chSet.ID, IsUpdate: chSet.IsUpdate}
+
+	if !opts.NonInteractive {
+		sa.notify(ApprovalRequested{Stack: stackCfg.DisplayName(), ChangeSetID: chSet.ID})
+
+		err = untilCanceled(ctx, func() error {
+			return sa.approver.ApproveSync(SyncApproval{Stack: stackCfg.DisplayName(), ChangeSet: cs, ChangeSetHandle: chSet})
+		})
 		if err != nil {
-			return cs.Stack(), err
+			return cs.Stack(), true, err
 		}
 	}
 
+	sa.notify(ApprovalGranted{Stack: stackCfg.DisplayName(), ChangeSetID: chSet.ID, Interactive: !opts.NonInteractive})
+
 	if chSet.IsUpdate {
-		err = stackCfg.Hooks.PreUpdate.Exec()
+		err = sa.execHooks(ctx, HookStagePreUpdate, stackCfg.Hooks.PreUpdate, stackCfg, change, nil)
 	} else {
-		err = stackCfg.Hooks.PreCreate.Exec()
+		err = sa.execHooks(ctx, HookStagePreCreate, stackCfg.Hooks.PreCreate, stackCfg, change, nil)
 	}
 
 	if err != nil {
-		return cs.Stack(), err
+		return cs.Stack(), true, err
 	}
 
-	wait := sa.showEvents(cs.Stack(), logger)
+	executed = true
+	stopEvents := sa.streamEvents(cs.Stack(), stackCfg.DisplayName(), opts.OnStackEvent)
 
-	err = chSet.Exec()
+	err = untilCanceled(ctx, chSet.Exec)
 
-	wait <- true
-	<-wait
+	stopEvents()
+
+	if errors.Is(err, ErrInterrupted) {
+		logger.Warn("The stack keeps being changed by cloudformation")
+		return cs.Stack(), true, err
+	}
 
 	if err != nil {
-		return cs.Stack(), err
+		return cs.Stack(), true, sa.explainFailure(cs.Stack(), err, logger)
+	}
+
+	// the info fetched before the change is outdated, so it's fetched again
+	// for the post hooks to get the current outputs
+	if len(stackCfg.Hooks.Post)+len(stackCfg.Hooks.PostCreate)+len(stackCfg.Hooks.PostUpdate) > 0 {
+		cs.Stack().Refresh()
 	}
 
 	if chSet.IsUpdate {
-		err = stackCfg.Hooks.PostUpdate.Exec()
+		err = sa.execHooks(ctx, HookStagePostUpdate, stackCfg.Hooks.PostUpdate, stackCfg, change, cs.Stack())
 	} else {
-		err = stackCfg.Hooks.PostCreate.Exec()
+		err = sa.execHooks(ctx, HookStagePostCreate, stackCfg.Hooks.PostCreate, stackCfg, change, cs.Stack())
 	}
 
-	if err != nil {
-		return cs.Stack(), err
+	return cs.Stack(), true, err
+}
+
+// explainFailure looks up the root cause of the failed stack operation and
+// attaches it to the returned error.
+func (sa SA) explainFailure(stack *awscf.Stack, err error, logger *cli.Logger) error {
+	failures, causeErr := stack.RootCauses()
+	if causeErr != nil {
+		logger.Warnf("failed to find the root cause of the failure: %s", causeErr)
+		return err
 	}
 
-	logger.Print(sa.cli.Color.Success("Synchronization is complete"))
+	if len(failures) == 0 {
+		return err
+	}
+
+	return &awscf.FailureError{Err: err, Failures: failures}
+}
+
+// deleteChangeSet removes the change set that is not going to be executed
+// together with the stack left in REVIEW_IN_PROGRESS state.
+func (sa SA) deleteChangeSet(chSet *awscf.ChangeSetHandle, logger *cli.Logger) {
+	if chSet == nil || chSet.ID == "" {
+		return
+	}
+
+	if err := chSet.Delete(); err != nil {
+		logger.Warnf("Error while cleaning up: %s", err)
+		return
+	}
+
+	logger.Infof("Change set is deleted: %s", chSet.ID)
+}
+
+// cancelOnInterrupt calls cancel when the program receives SIGINT or SIGTERM.
+// Only the first signal is handled, the next one terminates the program as
+// usual. The returned function stops the handling of interruption.
+func cancelOnInterrupt(cancel context.CancelFunc, logger *cli.Logger) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			logger.Warn("Interrupted")
+			cancel()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
 
-	return cs.Stack(), nil
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// untilCanceled runs fn and returns its error. ErrInterrupted is returned
+// without waiting for fn if ctx is canceled first, since fn may be blocked by
+// the prompt. fn isn't run at all if ctx is already canceled.
+func untilCanceled(ctx context.Context, fn func() error) error {
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrInterrupted
+	}
 }
 
-func (sa SA) register(cs *awscf.ChangeSet, logger *cli.Logger) (*awscf.ChangeSetHandle, error) {
+// register creates the change set. The change set is never created once ctx
+// is canceled, so the one that was being created when the program was
+// interrupted is the last one.
+func (sa SA) register(ctx context.Context, cs *awscf.ChangeSet, name string, logger *cli.Logger, opts SyncOptions) (*awscf.ChangeSetHandle, error) {
 	chSet, err := cs.Register()
 
 	if errors.Is(err, awscf.ErrStackAlreadyInProgress) {
 		logger.Warn(err.Error())
 		logger.Warn("Will wait until the current operation is complete")
 
-		wait := sa.showEvents(cs.Stack(), logger)
+		stopEvents := sa.streamEvents(cs.Stack(), name, opts.OnStackEvent)
 
-		waitErr := cs.Stack().Wait()
+		waitErr := untilCanceled(ctx, cs.Stack().Wait)
 
-		wait <- true
-		<-wait
+		stopEvents()
 
 		if waitErr != nil {
 			return chSet, waitErr
@@ -150,54 +365,48 @@ func (sa SA) register(cs *awscf.ChangeSet, logger *cli.Logger) (*awscf.ChangeSet
 
 	var paramerr *awscf.ParametersMissingError
 
-	if errors.As(err, &paramerr) {
+	if errors.As(err, &paramerr) && !opts.NonInteractive {
 		logger.Warn(paramerr.Error())
 
 		for _, p := range paramerr.MissingParameters {
-			response, rerr := sa.cli.Ask("Enter %s: ", p)
-			MustSucceed(rerr)
+			var response string
+
+			rerr := untilCanceled(ctx, func() (err error) {
+				response, err = sa.cli.Ask("Enter %s: ", p)
+				return err
+			})
+			if rerr != nil {
+				return chSet, rerr
+			}
+
 			cs.WithParameter(p, response)
 		}
 
+		if ctx.Err() != nil {
+			return chSet, ErrInterrupted
+		}
+
 		chSet, err = cs.Register()
 	}
 
 	return chSet, err
 }
 
-func (sa SA) showEvents(stack *awscf.Stack, logger *cli.Logger) chan bool {
-	wait := make(chan bool)
-
-	if _, err := stack.EventsTrack().FreshEvents(); err != nil {
-		logger.Warnf("got an error while requesting stack events: %s", err)
-	}
-
-	go func() {
-		writer := cli.NewColWriter(sa.cli.Writer, " ")
-
-		for {
-			events, err := stack.EventsTrack().FreshEvents()
-			if err != nil {
-				logger.Warnf("got an error while requesting stack events: %s", err)
-			}
-
-			for _, e := range events.Reversed() {
-				logger.Fprint(writer, sa.sprintEvent(e))
-			}
-
-			writer.Flush()
-
-			select {
-			case <-wait:
-				wait <- true
-				return
-			default:
-				time.Sleep(2 * time.Second)
+// streamEvents notifies the observers about the events of the stack as they
+// appear. The events are also passed to onEvent if it's not nil. The returned
+// function stops the streaming once the remaining events are delivered.
+func (sa SA) streamEvents(stack *awscf.Stack, name string, onEvent func(string, awscf.StackEvent)) (stop func()) {
+	return stack.StreamEvents(eventsPollInterval, func(events awscf.StackEvents) {
+		if onEvent != nil {
+			for _, e := range events {
+				onEvent(name, e)
 			}
 		}
-	}()
 
-	return wait
+		sa.notify(StackEventsReceived{Stack: name, Events: events})
+	}, func(err error) {
+		sa.notify(StackEventsFailed{Stack: name, Err: err})
+	})
 }
 
 func (sa SA) showChanges(changes []awscf.Change) {
@@ -205,7 +414,7 @@ func (sa SA) showChanges(changes []awscf.Change) {
 		t := cli.NewTable()
 		t.Header("Action", "Resource Type", "Resource ID", "Replacement needed")
 
-		for _, c := range changes {
+		awscf.WalkChanges(changes, func(c awscf.Change, depth int) {
 			action := sa.cli.Color.Neutral(c.Action)
 
 			switch strings.ToLower(c.Action) {
@@ -215,57 +424,67 @@ func (sa SA) showChanges(changes []awscf.Change) {
 				action = sa.cli.Color.Fail(c.Action)
 			}
 
-			repl := sa.cli.Color.Success(fmt.Sprintf("%t", c.ReplacementNeeded))
-			if c.ReplacementNeeded {
-				repl = sa.cli.Color.Fail(fmt.Sprintf("%t", c.ReplacementNeeded))
-			}
-
-			t.Row(action, c.ResourceType, c.LogicalResourceID, repl)
-		}
+			t.Row(action, c.ResourceType, nestedResourceID(c.LogicalResourceID, depth), sa.colorizedReplacement(c))
+		})
 
 		sa.cli.Print(t.Render())
 	}
 }
 
-func (sa SA) letUserChooseNextAction(chSet *awscf.ChangeSet) error {
-	var actionErr error
-
-	continueSync := false
-
-	for !continueSync && actionErr == nil {
-		err := sa.cli.Prompt([]cli.PromptCmd{
-			{
-				Description:   "[s]ync",
-				TriggerInputs: []string{"s", "sync"},
-				Action: func() {
-					continueSync = true
-				},
-			},
-			{
-				Description:   "[d]iff",
-				TriggerInputs: []string{"d", "diff"},
-				Action: func() {
-					diff, derr := awscf.ChSetDiff{Color: sa.cli.Color}.Diff(chSet)
-					actionErr = derr
-
-					if derr == nil {
-						sa.cli.Print(diff)
-					}
-				},
-			},
-			{
-				Description:   "[q]uit",
-				TriggerInputs: []string{"q", "quit"},
-				Action: func() {
-					sa.cli.Error("Interrupted by user")
-					actionErr = errors.New("sync is canceled")
-				},
-			},
-		})
-		if !errors.Is(err, cli.ErrPromptCommandIsNotKnown) {
-			MustSucceed(err)
+func (sa SA) colorizedReplacement(c awscf.Change) string {
+	switch {
+	case c.ReplacementNeeded:
+		return sa.cli.Color.Fail(fmt.Sprintf("%t", c.ReplacementNeeded))
+	case c.Replacement == cloudformation.ReplacementConditional:
+		return sa.cli.Color.Warn("conditional")
+	}
+
+	return sa.cli.Color.Success(fmt.Sprintf("%t", c.ReplacementNeeded))
+}
+
+// showChangeDetails shows expanded view of the changes: changed properties,
+// whether the change requires recreation of the resource and what caused the
+// change.
+func (sa SA) showChangeDetails(changes []awscf.Change) {
+	t := cli.NewTable()
+	t.Header("Resource ID", "Replacement", "Property", "Requires recreation", "Caused by")
+
+	awscf.WalkChanges(changes, func(c awscf.Change, depth int) {
+		resourceID := nestedResourceID(c.LogicalResourceID, depth)
+
+		if len(c.Details) == 0 {
+			t.Row(resourceID, sa.colorizedReplacement(c), c.Action, "", "")
+			return
 		}
+
+		for i, d := range c.Details {
+			id, repl := "", ""
+			if i == 0 {
+				id, repl = resourceID, sa.colorizedReplacement(c)
+			}
+
+			recreation := d.RequiresRecreation
+
+			switch recreation {
+			case cloudformation.RequiresRecreationAlways:
+				recreation = sa.cli.Color.Fail(recreation)
+			case cloudformation.RequiresRecreationConditionally:
+				recreation = sa.cli.Color.Warn(recreation)
+			}
+
+			t.Row(id, repl, d.Target(), recreation, d.Cause())
+		}
+	})
+
+	sa.cli.Print(t.Render())
+}
+
+// nestedResourceID indents ID of the resource of the nested stack according
+// to its depth so the changes are shown hierarchically.
+func nestedResourceID(id string, depth int) string {
+	if depth == 0 {
+		return id
 	}
 
-	return actionErr
+	return strings.Repeat("  ", depth-1) + "└─ " + id
 }
@@ -0,0 +1,172 @@
+package assembly
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/conf"
+)
+
+// TargetsError is returned when the sync of one or more targets of the stack
+// fails.
+type TargetsError struct {
+	// Errs are the errors of the failed targets keyed by the display name of
+	// the target stack.
+	Errs map[string]error
+
+	names []string
+}
+
+func (e *TargetsError) add(name string, err error) {
+	if e.Errs == nil {
+		e.Errs = map[string]error{}
+	}
+
+	e.Errs[name] = err
+	e.names = append(e.names, name)
+}
+
+func (e *TargetsError) Error() string {
+	lines := make([]string, 0, len(e.names)+1)
+	lines = append(lines, fmt.Sprintf("sync of %d target(s) failed:", len(e.names)))
+
+	for _, name := range e.names {
+		lines = append(lines, fmt.Sprintf("  %s: %s", name, e.Errs[name]))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the error of the first failed target.
+func (e *TargetsError) Unwrap() error {
+	return e.Errs[e.names[0]]
+}
+
+// syncTargets syncs the stacks expanded from the targets of one stack. In
+// non-interactive mode they are synced in parallel, at most concurrency
+// stacks at a time (no limit if concurrency is zero). No more targets are
+// started once one of them fails.
+func (sa SA) syncTargets(ctx context.Context, targets []conf.Config, concurrency int, opts SyncOptions) ([]*awscf.Stack, error) {
+	if !opts.NonInteractive || len(targets) < 2 {
+		syncedStacks := []*awscf.Stack{}
+
+		for _, t := range targets {
+			ss, err := sa.syncRecursively(ctx, t, opts)
+			syncedStacks = append(syncedStacks, ss...)
+
+			if err != nil {
+				return syncedStacks, err
+			}
+		}
+
+		return syncedStacks, nil
+	}
+
+	psa := sa.withoutLiveProgress()
+
+	return syncInParallel(ctx, targets, concurrency, func(ctx context.Context, t conf.Config) ([]*awscf.Stack, error) {
+		return psa.syncRecursively(ctx, t, opts)
+	})
+}
+
+// syncInParallel calls syncTarget for the targets, at most concurrency of
+// them at a time (no limit if concurrency is zero). No more targets are
+// started once one of them fails. The errors of the failed targets are
+// returned as TargetsError.
+func syncInParallel(
+	ctx context.Context,
+	targets []conf.Config,
+	concurrency int,
+	syncTarget func(context.Context, conf.Config) ([]*awscf.Stack, error),
+) ([]*awscf.Stack, error) {
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+
+	results := make([][]*awscf.Stack, len(targets))
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+
+	for i, t := range targets {
+		sem <- struct{}{}
+
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+
+		if stop {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+
+		go func(i int, t conf.Config) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i], errs[i] = syncTarget(ctx, t)
+
+			if errs[i] != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i, t)
+	}
+
+	wg.Wait()
+
+	syncedStacks := []*awscf.Stack{}
+	targetsErr := &TargetsError{}
+
+	for i, t := range targets {
+		syncedStacks = append(syncedStacks, results[i]...)
+
+		if errs[i] != nil {
+			targetsErr.add(t.DisplayName(), errs[i])
+		}
+	}
+
+	if len(targetsErr.names) > 0 {
+		return syncedStacks, targetsErr
+	}
+
+	return syncedStacks, nil
+}
+
+// withoutLiveProgress returns the copy of SA that prints the stack events line
+// by line. The live view can be redrawn only if it's the last printed thing,
+// which is not the case when several stacks are synced in parallel.
+func (sa SA) withoutLiveProgress() SA {
+	if !sa.liveProgress {
+		return sa
+	}
+
+	psa := sa
+	psa.liveProgress = false
+	psa.observers = make([]Observer, len(sa.observers))
+
+	for i, o := range sa.observers {
+		if _, ok := o.(*consoleObserver); ok {
+			o = newConsoleObserver(&psa)
+		}
+
+		psa.observers[i] = o
+	}
+
+	if _, ok := sa.approver.(consoleApprover); ok {
+		psa.approver = consoleApprover{&psa}
+	}
+
+	return psa
+}
@@ -0,0 +1,117 @@
+package assembly
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/molecule-man/stack-assembly/awscf"
+	"github.com/molecule-man/stack-assembly/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncInParallelDoesntExceedConcurrency(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		running    int
+		maxRunning int
+	)
+
+	stacks, err := syncInParallel(context.Background(), targetConfigs("a", "b", "c", "d", "e", "f"), 2,
+		func(_ context.Context, t conf.Config) ([]*awscf.Stack, error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			return []*awscf.Stack{{Name: t.Name}}, nil
+		})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, stackNames(stacks))
+	assert.Equal(t, 2, maxRunning)
+}
+
+func TestSyncInParallelDoesntStartTargetsAfterFailure(t *testing.T) {
+	started := []string{}
+
+	stacks, err := syncInParallel(context.Background(), targetConfigs("a", "b", "c"), 1,
+		func(_ context.Context, t conf.Config) ([]*awscf.Stack, error) {
+			started = append(started, t.Name)
+
+			if t.Name == "b" {
+				return nil, errors.New("boom")
+			}
+
+			return []*awscf.Stack{{Name: t.Name}}, nil
+		})
+
+	assert.EqualError(t, err, "sync of 1 target(s) failed:\n  b: boom")
+	assert.Equal(t, []string{"a", "b"}, started)
+	assert.Equal(t, []string{"a"}, stackNames(stacks))
+}
+
+func TestSyncInParallelAggregatesErrorsOfTargets(t *testing.T) {
+	errA := errors.New("boom a")
+	errC := errors.New("boom c")
+
+	// none of the targets finishes before all of them are started
+	var started sync.WaitGroup
+	started.Add(3)
+
+	stacks, err := syncInParallel(context.Background(), targetConfigs("a", "b", "c"), 0,
+		func(_ context.Context, t conf.Config) ([]*awscf.Stack, error) {
+			started.Done()
+			started.Wait()
+
+			switch t.Name {
+			case "a":
+				return nil, errA
+			case "c":
+				return nil, errC
+			}
+
+			return []*awscf.Stack{{Name: t.Name}}, nil
+		})
+
+	assert.EqualError(t, err, "sync of 2 target(s) failed:\n  a: boom a\n  c: boom c")
+	assert.Equal(t, []string{"b"}, stackNames(stacks))
+
+	var targetsErr *TargetsError
+
+	require.True(t, errors.As(err, &targetsErr))
+	assert.Equal(t, map[string]error{"a": errA, "c": errC}, targetsErr.Errs)
+	assert.True(t, errors.Is(err, errA))
+	assert.False(t, errors.Is(err, errC))
+}
+
+func targetConfigs(names ...string) []conf.Config {
+	cfgs := make([]conf.Config, len(names))
+
+	for i, name := range names {
+		cfgs[i] = conf.Config{Name: name}
+	}
+
+	return cfgs
+}
+
+func stackNames(stacks []*awscf.Stack) []string {
+	names := make([]string, len(stacks))
+
+	for i, s := range stacks {
+		names[i] = s.Name
+	}
+
+	return names
+}
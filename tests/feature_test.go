@@ -196,6 +196,10 @@ func (f *feature) iRun(cmd string) error {
 
 	err := root.Execute()
 
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+
 	f.LastOutput = buf.String()
 	f.LastErr = err
 
@@ -506,7 +510,12 @@ func FeatureContext(s *godog.Suite) {
 		f.ScenarioName = re.ReplaceAllString(scenario.Name, "-")
 		f.ScenarioID = fmt.Sprintf("%.80s-%d", f.ScenarioName, rand.Int63())
 
-		f.cf = f.aws().Must(cfg).CF
+		a, err := f.aws().New(cfg)
+		if err != nil {
+			panic(err)
+		}
+
+		f.cf = a.CF
 		f.testDir = filepath.Join(".tmp", "stas_test_"+f.ScenarioID)
 		f.fs = vfs{
 			afero.NewBasePathFs(afero.NewOsFs(), f.testDir),
@@ -46,14 +46,8 @@ Feature: stas diff
             """
             --- old/stastest-diff1-%scenarioid%
             +++ new/stastest-diff1-%scenarioid%
-            @@ -1,5 +1,5 @@
-             Resources:
-            -  EcsCluster:
-            +  EcsCluster1:
-                 Type: AWS::ECS::Cluster
-                 Properties:
-            -      ClusterName: stastest1-%scenarioid%
-            +      ClusterName: stastest1-mod-%scenarioid%
+            - Resources.EcsCluster: {"Properties":{"ClusterName":"stastest1-%scenarioid%"},"Type":"AWS::ECS::Cluster"}
+            + Resources.EcsCluster1: {"Properties":{"ClusterName":"stastest1-mod-%scenarioid%"},"Type":"AWS::ECS::Cluster"}
             """
 
     @short
@@ -137,17 +131,5 @@ Feature: stas diff
             """
             --- old/stastest-json-yaml-diff-%scenarioid%
             +++ new/stastest-json-yaml-diff-%scenarioid%
-            @@ -4,11 +4,11 @@
-                   "Properties": {
-                     "ClusterName": "stastest-json-yaml-diff-%scenarioid%",
-                     "Tags": [
-                       {
-                         "Key": "SOME_TAG",
-            -            "Value": "some value"
-            +            "Value": "some other value"
-                       }
-                     ]
-                   },
-                   "Type": "AWS::ECS::Cluster"
-                 }
+            ~ Resources.EcsCluster.Properties.Tags[0].Value: some value → some other value
             """
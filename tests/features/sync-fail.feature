@@ -25,4 +25,4 @@ Feature: stas sync failure handling
             """
             failed to wait changeset. Status: FAILED, StatusReason: Transform AWS::Include failed with: S3 bucket [non-existent-bucket-%scenarioid%] does not exist.
             """
-        And stack "stastest-fail1-%scenarioid%" should have status "REVIEW_IN_PROGRESS"
+        And stack "stastest-fail1-%scenarioid%" should not exist
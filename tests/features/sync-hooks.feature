@@ -20,13 +20,15 @@ Feature: stas sync with hooks
                   post:
                     - ["sh", "-c", "echo stack post executed >> %testdir%/hooks.log"]
                   precreate:
-                    - ["sh", "-c", "echo stack precreate executed >> %testdir%/hooks.log"]
+                    - "echo stack precreate executed, update: $STAS_IS_UPDATE >> %testdir%/hooks.log"
                   postcreate:
                     - ["sh", "-c", "echo stack postcreate executed >> %testdir%/hooks.log"]
                   preupdate:
-                    - ["sh", "-c", "echo stack preupdate executed >> %testdir%/hooks.log"]
+                    - "echo stack preupdate executed, update: $STAS_IS_UPDATE >> %testdir%/hooks.log"
                   postupdate:
-                    - ["sh", "-c", "echo stack postupdate executed >> %testdir%/hooks.log"]
+                    - shell: "echo stack postupdate executed >> hooks.log"
+                      dir: "%testdir%"
+                      timeoutSeconds: 10
             """
         And file "tpls/stack1.yml" exists:
             """
@@ -41,7 +43,7 @@ Feature: stas sync with hooks
             """
             root pre executed
             stack pre executed
-            stack precreate executed
+            stack precreate executed, update: false
             stack postcreate executed
             stack post executed
             root post executed
@@ -59,7 +61,7 @@ Feature: stas sync with hooks
             """
             root pre executed
             stack pre executed
-            stack preupdate executed
+            stack preupdate executed, update: true
             stack postupdate executed
             stack post executed
             root post executed
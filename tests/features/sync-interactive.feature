@@ -75,13 +75,7 @@ Feature: stas sync in interactive mode
 
             --- /dev/null
             +++ new/stastest-%scenarioid%
-            @@ -1 +1,5 @@
-            -
-            +Resources:
-            +    Cluster:
-            +        Type: AWS::ECS::Cluster
-            +        Properties:
-            +            ClusterName: stastest-%scenarioid%
+            + Resources.Cluster: {"Properties":{"ClusterName":"stastest-%scenarioid%"},"Type":"AWS::ECS::Cluster"}
 
             *** Commands ***
               [s]ync